@@ -0,0 +1,294 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/cast"
+)
+
+const (
+	defaultMultipartMemory = 32 << 20 // 32 MB
+)
+
+var (
+	// ErrBindTarget is returned when the bind target is not a pointer to struct
+	ErrBindTarget = errors.New("web: bind target must be a pointer to struct")
+
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// bindSources are the struct tags which are used to bind values from the request.  Later sources override the
+// value of the earlier sources.
+var bindSources = []string{"form", "query", "header", "param"}
+
+// Bind fills the struct `obj` from the request body, path parameters, query string, form and headers and then
+// validates the struct by the `validate` tags.  The body is decoded based on the Content-Type header (JSON or XML).
+// Other values are bound by struct tags, ex:
+//
+//	type ListUsersRequest struct {
+//		OrgID  int    `param:"org_id" validate:"required"`
+//		Page   int    `query:"page" validate:"min=1"`
+//		Tenant string `header:"X-Tenant"`
+//	}
+//
+// The error will be `ValidationErrors` if any field is invalid.
+func (c *Context) Bind(obj interface{}) error {
+	val := reflect.ValueOf(obj)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+
+	if err := c.bindBody(obj); err != nil {
+		return err
+	}
+
+	var errs ValidationErrors
+
+	for _, source := range bindSources {
+		getter, err := c.bindGetter(source)
+		if err != nil {
+			return err
+		}
+
+		if getter == nil {
+			continue
+		}
+
+		errs = append(errs, bindStruct(val.Elem(), source, getter)...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return Validate(obj)
+}
+
+func (c *Context) bindBody(obj interface{}) error {
+	req := c.Request
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+
+	var err error
+
+	switch contentType := c.ContentType(); {
+	case strings.HasSuffix(contentType, "/json") || strings.HasSuffix(contentType, "+json"):
+		err = json.NewDecoder(req.Body).Decode(obj)
+	case strings.HasSuffix(contentType, "/xml") || strings.HasSuffix(contentType, "+xml"):
+		err = xml.NewDecoder(req.Body).Decode(obj)
+	default:
+		return nil
+	}
+
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return bodyError(err)
+}
+
+// bodyError returns HTTPError with 400 status code if the body is malformed.  http.MaxBytesError is returned as it is,
+// so it is rendered as 413 by `ToHTTPError`.
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+
+	return NewHTTPError(http.StatusBadRequest).Wrap(err)
+}
+
+func (c *Context) bindGetter(source string) (func(key string) []string, error) {
+	req := c.Request
+
+	switch source {
+	case "param":
+		return func(key string) []string {
+			for _, param := range c.params {
+				if param.Key == key {
+					return []string{param.Value}
+				}
+			}
+			return nil
+		}, nil
+	case "query":
+		if c.query == nil {
+			c.query = req.URL.Query()
+		}
+
+		return func(key string) []string {
+			return c.query[key]
+		}, nil
+	case "header":
+		return func(key string) []string {
+			return req.Header.Values(key)
+		}, nil
+	case "form":
+		contentType := c.ContentType()
+		if contentType != "application/x-www-form-urlencoded" && contentType != "multipart/form-data" {
+			return nil, nil
+		}
+
+		var err error
+		if contentType == "multipart/form-data" {
+			err = req.ParseMultipartForm(defaultMultipartMemory)
+		} else {
+			err = req.ParseForm()
+		}
+
+		if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return nil, bodyError(err)
+		}
+
+		return func(key string) []string {
+			if values := req.PostForm[key]; len(values) > 0 {
+				return values
+			}
+
+			if req.MultipartForm != nil {
+				return req.MultipartForm.Value[key]
+			}
+
+			return nil
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func bindStruct(val reflect.Value, source string, getter func(key string) []string) ValidationErrors {
+	var errs ValidationErrors
+
+	typ := val.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldVal := val.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get(source)
+		if tag == "-" {
+			continue
+		}
+
+		if len(tag) == 0 {
+			// embedded struct shares the same tags with the parent struct
+			if field.Anonymous && fieldVal.Kind() == reflect.Struct {
+				errs = append(errs, bindStruct(fieldVal, source, getter)...)
+			}
+			continue
+		}
+
+		values := getter(tag)
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setField(fieldVal, values); err != nil {
+			errs = append(errs, FieldError{
+				Field:   tag,
+				Rule:    "type",
+				Value:   values[0],
+				Message: fmt.Sprintf("%s must be a valid %s", tag, fieldVal.Type().String()),
+			})
+		}
+	}
+
+	return errs
+}
+
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setField(elem.Elem(), values); err != nil {
+			return err
+		}
+
+		field.Set(elem)
+		return nil
+	}
+
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+
+		field.Set(slice)
+		return nil
+	}
+
+	return setValue(field, values[0])
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := cast.ToDuration(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() { //nolint:exhaustive
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := cast.ToInt64(value)
+		if err != nil {
+			return err
+		}
+
+		if field.OverflowInt(v) {
+			return fmt.Errorf("value %s overflows %s", value, field.Type().String())
+		}
+
+		field.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := cast.ToUint64(value)
+		if err != nil {
+			return err
+		}
+
+		if field.OverflowUint(v) {
+			return fmt.Errorf("value %s overflows %s", value, field.Type().String())
+		}
+
+		field.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := cast.ToFloat64(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(v)
+	case reflect.Bool:
+		v, err := cast.ToBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(v)
+	default:
+		return fmt.Errorf("type %s is not supported", field.Type().String())
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bindAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type bindRequest struct {
+	ID       int           `param:"id" validate:"required,min=1"`
+	Page     int           `query:"page" validate:"min=1,max=100"`
+	Tags     []string      `query:"tag"`
+	Timeout  time.Duration `query:"timeout"`
+	Tenant   string        `header:"X-Tenant" validate:"required"`
+	Name     string        `json:"name" validate:"required,min=2,max=10"`
+	Role     string        `json:"role" validate:"oneof=admin member"`
+	Handle   string        `json:"handle" validate:"regex=^[a-z0-9_,]+$"`
+	Enabled  *bool         `query:"enabled"`
+	Address  bindAddress   `json:"address"`
+	internal string
+}
+
+func TestContextBind(t *testing.T) {
+	_, _, s := createTestContext()
+
+	var result bindRequest
+	var bindErr error
+
+	s.Post("/users/:id", func(c *Context) error {
+		bindErr = c.Bind(&result)
+		return nil
+	})
+
+	body := `{"name":"john","role":"admin","handle":"john_1","address":{"city":"taipei"}}`
+	req, _ := http.NewRequest("POST", "/users/5?page=2&tag=a&tag=b&timeout=3s&enabled=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "nite")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.NoError(t, bindErr)
+	assert.Equal(t, 5, result.ID)
+	assert.Equal(t, 2, result.Page)
+	assert.Equal(t, []string{"a", "b"}, result.Tags)
+	assert.Equal(t, 3*time.Second, result.Timeout)
+	assert.Equal(t, "nite", result.Tenant)
+	assert.Equal(t, "john", result.Name)
+	assert.Equal(t, "taipei", result.Address.City)
+	assert.True(t, *result.Enabled)
+}
+
+func TestContextBindForm(t *testing.T) {
+	_, _, s := createTestContext()
+
+	var result struct {
+		Name string `form:"name"`
+		Age  uint8  `form:"age"`
+	}
+	var bindErr error
+
+	s.Post("/form", func(c *Context) error {
+		bindErr = c.Bind(&result)
+		return nil
+	})
+
+	req, _ := http.NewRequest("POST", "/form", strings.NewReader("name=john&age=18"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.NoError(t, bindErr)
+	assert.Equal(t, "john", result.Name)
+	assert.Equal(t, uint8(18), result.Age)
+}
+
+func TestContextBindErrors(t *testing.T) {
+	_, _, s := createTestContext()
+
+	var bindErr error
+
+	s.Post("/users/:id", func(c *Context) error {
+		var result bindRequest
+		bindErr = c.Bind(&result)
+		return nil
+	})
+
+	// type error
+	req, _ := http.NewRequest("POST", "/users/abc", nil)
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	var errs ValidationErrors
+	assert.True(t, errors.As(bindErr, &errs))
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "id", errs[0].Field)
+	assert.Equal(t, "type", errs[0].Rule)
+
+	// validation errors
+	body := `{"name":"j","role":"guest","handle":"John"}`
+	req, _ = http.NewRequest("POST", "/users/1?page=101", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, errors.As(bindErr, &errs))
+
+	rules := map[string]string{}
+	for _, fieldErr := range errs {
+		rules[fieldErr.Field] = fieldErr.Rule
+	}
+
+	assert.Equal(t, map[string]string{
+		"page":         "max",
+		"X-Tenant":     "required",
+		"name":         "min",
+		"role":         "oneof",
+		"handle":       "regex",
+		"address.city": "required",
+	}, rules)
+
+	// invalid target
+	c, _, _ := createTestContext()
+	assert.ErrorIs(t, c.Bind(bindRequest{}), ErrBindTarget)
+}
+
+func TestContextBindMalformedBody(t *testing.T) {
+	_, _, s := createTestContext()
+	s.MaxRequestBodySize = 32
+
+	s.Post("/users/:id", func(c *Context) error {
+		var result bindRequest
+		return c.Bind(&result)
+	})
+
+	// malformed json
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/1", strings.NewReader(`{"name":`+"\n"))
+	req.Header.Set("Content-Type", "application/json")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// malformed xml
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/1", strings.NewReader(`<name>john</nam>`))
+	req.Header.Set("Content-Type", "application/xml")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// body is too large
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/1", strings.NewReader(`{"name":"`+strings.Repeat("a", 64)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// malformed form
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/1", strings.NewReader("name=%zz"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/1", strings.NewReader("--x--"))
+	req.Header.Set("Content-Type", "multipart/form-data")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// form is too large
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/1", strings.NewReader("name="+strings.Repeat("a", 64)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestValidate(t *testing.T) {
+	type item struct {
+		Tags  []string `validate:"min=1,max=2"`
+		Price float64  `validate:"min=0.5"`
+		Note  string   `validate:"max=3"`
+	}
+
+	assert.NoError(t, Validate(&item{Tags: []string{"a"}, Price: 1}))
+	assert.NoError(t, Validate(item{Tags: []string{"a", "b"}, Price: 0.5, Note: "中文字"}))
+
+	err := Validate(&item{Tags: []string{"a", "b", "c"}, Price: 0.1, Note: "abcd"})
+	var errs ValidationErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 3)
+	assert.Equal(t, "Tags must be at most 2 in length", errs[0].Message)
+	assert.Equal(t, "Price must be 0.5 or greater", errs[1].Message)
+}
+
+func TestValidateInvalidRule(t *testing.T) {
+	type minRequest struct {
+		Page int `validate:"min=one"`
+	}
+	type regexRequest struct {
+		Handle string `json:"handle" validate:"regex=^[a-z"`
+	}
+
+	// the malformed rule is an error instead of a panic
+	for i := 0; i < 2; i++ {
+		err := Validate(&minRequest{Page: 1})
+		assert.ErrorIs(t, err, ErrInvalidRule)
+		assert.Contains(t, err.Error(), "min=one")
+		assert.Contains(t, err.Error(), "Page")
+	}
+
+	err := Validate(&regexRequest{Handle: "john"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.Contains(t, err.Error(), "handle")
+}
+
+func TestValidateZeroValue(t *testing.T) {
+	type pageRequest struct {
+		Page  int  `validate:"min=1"`
+		Limit *int `validate:"min=1"`
+		Size  int  `validate:"required,min=1"`
+	}
+
+	zero := 0
+	one := 1
+
+	// the zero value of non-pointer field is skipped if it isn't required
+	assert.NoError(t, Validate(&pageRequest{Size: 1}))
+	assert.NoError(t, Validate(&pageRequest{Limit: &one, Size: 1}))
+
+	err := Validate(&pageRequest{Limit: &zero})
+	var errs ValidationErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "Limit", errs[0].Field)
+	assert.Equal(t, "min", errs[0].Rule)
+	assert.Equal(t, "Size", errs[1].Field)
+	assert.Equal(t, "required", errs[1].Rule)
+}
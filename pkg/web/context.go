@@ -1,18 +1,26 @@
 package web
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"mime"
 	"mime/multipart"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/nite-coder/blackbear/pkg/log"
 )
 
 var (
@@ -23,6 +31,42 @@ var (
 	}
 )
 
+// MIME types which are used by `Negotiate`
+const (
+	MIMEJSON = "application/json"
+	MIMEXML  = "application/xml"
+	MIMEHTML = "text/html"
+	MIMEText = "text/plain"
+)
+
+// Keys of the values which are saved by the security middleware.  The values are available to the templates of
+// `Render` by `cspNonce` and `csrfToken` functions.
+const (
+	CSPNonceKey  = "csp_nonce"
+	CSRFTokenKey = "csrf_token"
+)
+
+var jsonpCallbackRegexp = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$.]*$`)
+
+// Negotiation contains the data for each format which is used by `Context.Negotiate`.  `Data` is used if the
+// data of the chosen format is nil.
+type Negotiation struct {
+	Offered  []string
+	HTMLName string
+	HTMLData interface{}
+	JSONData interface{}
+	XMLData  interface{}
+	TextData interface{}
+	Data     interface{}
+}
+
+func (n Negotiation) data(val interface{}) interface{} {
+	if val != nil {
+		return val
+	}
+	return n.Data
+}
+
 // Param is a single URL parameter, consisting of a key and a value.
 type Param struct {
 	Key   string
@@ -38,6 +82,9 @@ type Context struct {
 	query     url.Values
 	params    []Param
 	store     map[string]interface{}
+	route     *Route
+	// body limits the request body by MaxRequestBodySize
+	body *requestBody
 }
 
 // newContext returns a new context instance
@@ -49,24 +96,50 @@ func newContext(s *WebServer, req *http.Request, writer ResponseWriter) *Context
 	}
 }
 
-// Render returns html format
+// Render returns html format.  The view is rendered by `WebServer.Renderer` before the header is written, so the
+// error can still be handled by the ErrorHandler.
 func (c *Context) Render(code int, viewName string, data interface{}) error {
+	renderer := c.WebServer.Renderer
+	if renderer == nil {
+		return ErrRendererNotSet
+	}
+
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, viewName, data, c); err != nil {
+		return err
+	}
+
 	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
 	c.Writer.WriteHeader(code)
 
-	t, err := c.WebServer.template.Clone()
+	_, err := c.Writer.Write(buf.Bytes())
+	return err
+}
+
+// String returns string format
+func (c *Context) String(code int, s string) error {
+	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	c.Writer.WriteHeader(code)
+	_, err := c.Writer.Write([]byte(s))
+
 	if err != nil {
 		return err
 	}
 
-	viewPath := path.Join(c.WebServer.templateRootPath, "views", viewName)
-	t, err = t.ParseFiles(viewPath)
+	return nil
+}
+
+// JSON returns json format
+func (c *Context) JSON(code int, i interface{}) error {
+	b, err := json.Marshal(i)
 
 	if err != nil {
 		return err
 	}
 
-	err = t.ExecuteTemplate(c.Writer, viewName, data)
+	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.Writer.WriteHeader(code)
+	_, err = c.Writer.Write(b)
 
 	if err != nil {
 		return err
@@ -75,11 +148,23 @@ func (c *Context) Render(code int, viewName string, data interface{}) error {
 	return nil
 }
 
-// String returns string format
-func (c *Context) String(code int, s string) error {
-	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+// XML returns xml format
+func (c *Context) XML(code int, i interface{}) error {
+	b, err := xml.Marshal(i)
+
+	if err != nil {
+		return err
+	}
+
+	c.Writer.Header().Set("Content-Type", MIMEXML+"; charset=utf-8")
 	c.Writer.WriteHeader(code)
-	_, err := c.Writer.Write([]byte(s))
+	_, err = c.Writer.Write([]byte(xml.Header))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Writer.Write(b)
 
 	if err != nil {
 		return err
@@ -88,25 +173,140 @@ func (c *Context) String(code int, s string) error {
 	return nil
 }
 
-// JSON returns json format
-func (c *Context) JSON(code int, i interface{}) error {
+// JSONP returns json format which is wrapped by the callback function.  The callback name may only contain
+// letters, digits, `_`, `$` and `.`.
+func (c *Context) JSONP(code int, callback string, i interface{}) error {
+	if !jsonpCallbackRegexp.MatchString(callback) {
+		return fmt.Errorf("web: jsonp callback '%s' was invalid", callback)
+	}
+
 	b, err := json.Marshal(i)
 
 	if err != nil {
 		return err
 	}
 
-	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.Writer.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	c.Writer.Header().Set("X-Content-Type-Options", "nosniff")
 	c.Writer.WriteHeader(code)
-	_, err = c.Writer.Write(b)
 
+	buf := make([]byte, 0, len(callback)+len(b)+8)
+	buf = append(buf, "/**/"...)
+	buf = append(buf, callback...)
+	buf = append(buf, '(')
+	buf = append(buf, b...)
+	buf = append(buf, ");"...)
+
+	_, err = c.Writer.Write(buf)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Blob returns the bytes with the specific content type
+func (c *Context) Blob(code int, contentType string, b []byte) error {
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.WriteHeader(code)
+	_, err := c.Writer.Write(b)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Stream copies the content of reader to the response with the specific content type
+func (c *Context) Stream(code int, contentType string, r io.Reader) error {
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.WriteHeader(code)
+	_, err := io.Copy(c.Writer, r)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// File returns the content of the file.  `Range`, `If-Modified-Since` and `If-None-Match` request headers
+// are supported.  HTTPError with 404 status code is returned if the file doesn't exist.
+func (c *Context) File(filePath string) error {
+	f, err := os.Open(filepath.Clean(filePath))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return NewHTTPError(http.StatusNotFound).Wrap(err)
+		}
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
 	if err != nil {
 		return err
 	}
 
+	if fi.IsDir() {
+		return fmt.Errorf("web: %s is a directory", filePath)
+	}
+
+	http.ServeContent(c.Writer, c.Request, fi.Name(), fi.ModTime(), f)
 	return nil
 }
 
+// Attachment returns the file as an attachment, so the browser will download the file with the name
+func (c *Context) Attachment(filePath string, name string) error {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+	c.Writer.Header().Set("Content-Disposition", disposition)
+
+	return c.File(filePath)
+}
+
+// Negotiate returns the response in the format which is accepted by the client.  The format is chosen from
+// `Negotiation.Offered` based on the `Accept` request header.  If none of the format is acceptable,
+// HTTPError with 406 status code is returned.
+func (c *Context) Negotiate(code int, n Negotiation) error {
+	switch c.NegotiateFormat(n.Offered...) {
+	case MIMEJSON:
+		return c.JSON(code, n.data(n.JSONData))
+	case MIMEXML:
+		return c.XML(code, n.data(n.XMLData))
+	case MIMEHTML:
+		return c.Render(code, n.HTMLName, n.data(n.HTMLData))
+	case MIMEText:
+		return c.String(code, fmt.Sprint(n.data(n.TextData)))
+	default:
+		return NewHTTPError(http.StatusNotAcceptable)
+	}
+}
+
+// NegotiateFormat returns the format which is most preferred by the client.  The first offered format is
+// returned if the `Accept` request header doesn't exist, and an empty string is returned if none of the format
+// is acceptable.
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+
+	accept := c.RequestHeader("Accept")
+	if len(accept) == 0 {
+		return offered[0]
+	}
+
+	for _, accepted := range parseAccept(accept) {
+		for _, offer := range offered {
+			if matchMediaType(accepted, offer) {
+				return offer
+			}
+		}
+	}
+
+	return ""
+}
+
 // Redirect returns a HTTP redirect to the specific location.
 func (c *Context) Redirect(code int, location string) error {
 	if (code < 300 || code > 308) && code != 201 {
@@ -203,6 +403,20 @@ func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) (err
 	return nil
 }
 
+// CSPNonce returns the Content-Security-Policy nonce of the request which is generated by the secure middleware
+func (c *Context) CSPNonce() string {
+	nonce, _ := c.Get(CSPNonceKey)
+	s, _ := nonce.(string)
+	return s
+}
+
+// CSRFToken returns the CSRF token of the request which is issued by the csrf middleware
+func (c *Context) CSRFToken() string {
+	token, _ := c.Get(CSRFTokenKey)
+	s, _ := token.(string)
+	return s
+}
+
 // Get retrieves data from the context.
 func (c *Context) Get(key string) (interface{}, bool) {
 	var value interface{}
@@ -244,44 +458,101 @@ func (c *Context) Param(name string) string {
 	return ""
 }
 
+// RoutePath returns the path pattern of the matched route, ex: `/users/:id`.  An empty string is returned if
+// no route was matched.
+func (c *Context) RoutePath() string {
+	if c.route == nil {
+		return ""
+	}
+	return c.route.path
+}
+
 // ParamInt returns parameter by key and cast the value to int.
 func (c *Context) ParamInt(key string) (int, error) {
 	return strconv.Atoi(c.Param(key))
 }
 
-// ClientIP implements a best effort algorithm to return the real client IP, it parses
-// X-Real-IP and X-Forwarded-For in order to work properly with reverse-proxies such us: nginx or haproxy.
-// Use X-Forwarded-For before X-Real-Ip as nginx uses X-Real-Ip with the proxy's IP.
+// PeerCertificate returns the verified client certificate of mutual TLS.  It returns nil if the client didn't
+// send a certificate.
+func (c *Context) PeerCertificate() *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return c.Request.TLS.PeerCertificates[0]
+}
+
+// ClientIP returns the real client IP.  X-Forwarded-For, Forwarded (RFC 7239) and X-Real-Ip headers are only used
+// if the request was sent by one of `WebServer.TrustedProxies`, so the clients can't spoof their IP.  The hops are
+// walked from right to left and the first address which isn't a trusted proxy is the client IP.
 func (c *Context) ClientIP() string {
-	clientIP := c.RequestHeader("X-Forwarded-For")
+	remote := c.remoteAddr()
 
-	if index := strings.IndexByte(clientIP, ','); index >= 0 {
-		clientIP = clientIP[0:index]
+	if !c.fromTrustedProxy() {
+		if remote.IsValid() {
+			return remote.String()
+		}
+		return ""
 	}
 
-	clientIP = strings.TrimSpace(clientIP)
+	hops := headerValues(c.Request.Header.Values("X-Forwarded-For"))
+	if len(hops) == 0 {
+		hops = forwardedParams(c.Request.Header.Values("Forwarded"), "for")
+	}
 
-	if len(clientIP) > 0 {
-		return clientIP
+	if len(hops) == 0 {
+		if addr := parseNode(c.RequestHeader("X-Real-Ip")); addr.IsValid() {
+			return addr.String()
+		}
 	}
 
-	clientIP = strings.TrimSpace(c.RequestHeader("X-Real-Ip"))
+	client := remote
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr := parseNode(hops[i])
+		// the hop is obfuscated or invalid, so the last trusted proxy is the client
+		if !addr.IsValid() {
+			break
+		}
+
+		client = addr
 
-	if len(clientIP) > 0 {
-		return clientIP
+		if !c.WebServer.isTrustedProxy(addr) {
+			break
+		}
 	}
 
-	clientIP = strings.TrimSpace(clientIP)
+	return client.String()
+}
 
-	if len(clientIP) > 0 {
-		return clientIP
+// Scheme returns the scheme which the client used, "http" or "https".  X-Forwarded-Proto and Forwarded headers are
+// only used if the request was sent by one of `WebServer.TrustedProxies` and the value which was added by the
+// farthest trusted proxy is used, like `ClientIP`.
+func (c *Context) Scheme() string {
+	if c.fromTrustedProxy() {
+		proto := strings.ToLower(c.forwardedValue("X-Forwarded-Proto", "proto"))
+		if proto == "http" || proto == "https" {
+			return proto
+		}
 	}
 
-	if ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr)); err == nil {
-		return ip
+	if c.Request.TLS != nil {
+		return "https"
 	}
 
-	return ""
+	return "http"
+}
+
+// Host returns the host which the client requested.  X-Forwarded-Host and Forwarded headers are only used if the
+// request was sent by one of `WebServer.TrustedProxies` and the value which was added by the farthest trusted proxy
+// is used, like `ClientIP`.
+func (c *Context) Host() string {
+	if c.fromTrustedProxy() {
+		if host := c.forwardedValue("X-Forwarded-Host", "host"); len(host) > 0 {
+			return host
+		}
+	}
+
+	return c.Request.Host
 }
 
 // ContentType returns the Content-Type header of the request.
@@ -352,6 +623,29 @@ func (c *Context) RequestHeader(key string) string {
 	return c.Request.Header.Get(key)
 }
 
+// Copy returns a copy of the context which can be used after the handler returns, ex: by a goroutine.  The request
+// context of the copy isn't canceled when the request is done, the request body is empty and the response is
+// written to w.  Only the logger is carried to the new request context, because the other values, ex: the state of
+// the middleware, belong to the original request.
+func (c *Context) Copy(w http.ResponseWriter) *Context {
+	req := c.Request.Clone(log.FromContext(c.Request.Context()).WithContext(context.Background()))
+	req.Body = http.NoBody
+	req.ContentLength = 0
+
+	cp := newContext(c.WebServer, req, newResponseWriter().reset(w))
+	cp.params = append([]Param(nil), c.params...)
+	cp.route = c.route
+
+	if c.store != nil {
+		cp.store = make(map[string]interface{}, len(c.store))
+		for key, value := range c.store {
+			cp.store[key] = value
+		}
+	}
+
+	return cp
+}
+
 // StdContext return golang standard context
 func (c *Context) StdContext() context.Context {
 	ctx := c.Request.Context()
@@ -364,12 +658,79 @@ func (c *Context) SetStdContext(ctx context.Context) {
 	c.Request = c.Request.WithContext(ctx)
 }
 
+// SetMaxRequestBodySize overrides `WebServer.MaxRequestBodySize` for the request, so routes are able to accept
+// a larger or smaller body.  The limit is applied to the original body, so the readers which wrap the body, ex:
+// the decompression of Compress middleware, are kept.  The bytes which were already read are counted.
+func (c *Context) SetMaxRequestBodySize(size int64) {
+	if c.body == nil {
+		return
+	}
+	c.body.setLimit(size)
+}
+
+// MaxRequestBodySize returns the limit of the request body which is `WebServer.MaxRequestBodySize` or the value of
+// `SetMaxRequestBodySize`
+func (c *Context) MaxRequestBodySize() int64 {
+	if c.body == nil {
+		return c.WebServer.MaxRequestBodySize
+	}
+	return c.body.limit
+}
+
 func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
 	c.Request = req
 	c.Writer = c.Writer.reset(w)
 	c.store = nil
 	c.query = nil
 	c.params = nil
+	c.route = nil
+	c.body = nil
+}
+
+// requestBody is http.MaxBytesReader whose limit can be changed after the body was partially read.  The writer
+// must be the one of http.Server, so the connection is closed when the limit is exceeded.
+type requestBody struct {
+	body   io.ReadCloser
+	w      http.ResponseWriter
+	limit  int64
+	read   int64
+	reader io.ReadCloser
+}
+
+func newRequestBody(w http.ResponseWriter, body io.ReadCloser, limit int64) *requestBody {
+	b := &requestBody{
+		body: body,
+		w:    w,
+	}
+	b.setLimit(limit)
+	return b
+}
+
+func (b *requestBody) setLimit(limit int64) {
+	b.limit = limit
+
+	remaining := limit - b.read
+	if remaining < 0 {
+		remaining = 0
+	}
+	b.reader = http.MaxBytesReader(b.w, b.body, remaining)
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	b.read += int64(n)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		// the reader only knows the remaining bytes
+		return n, &http.MaxBytesError{Limit: b.limit}
+	}
+
+	return n, err
+}
+
+func (b *requestBody) Close() error {
+	return b.body.Close()
 }
 
 // FromContext return a web context from the standard context
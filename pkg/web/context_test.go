@@ -1,30 +1,83 @@
 package web
 
 import (
+	"context"
+	"encoding/xml"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestContextRemoteIpAddress(t *testing.T) {
-	c, _, _ := createTestContext()
-
-	c.Request, _ = http.NewRequest("POST", "/", nil)
-
-	c.Request.Header.Set("X-Real-IP", " 10.10.10.10  ")
-	assert.Equal(t, "10.10.10.10", c.ClientIP())
-	c.Request.Header.Del("X-Real-IP")
-
-	c.Request.Header.Set("X-Forwarded-For", "  20.20.20.20, 30.30.30.30")
-	assert.Equal(t, "20.20.20.20", c.ClientIP())
-	c.Request.Header.Set("X-Forwarded-For", "30.30.30.30  ")
-	assert.Equal(t, "30.30.30.30", c.ClientIP())
-
-	c.Request.Header.Del("X-Forwarded-For")
+	c, _, s := createTestContext()
+	s.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"}
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		value      string
+		expected   string
+	}{
+		{"untrusted remote", "40.40.40.40:42123", "X-Forwarded-For", "20.20.20.20", "40.40.40.40"},
+		{"trusted remote", "  10.0.0.1:42123 ", "X-Forwarded-For", "  20.20.20.20, 30.30.30.30", "30.30.30.30"},
+		{"trusted hops", "10.0.0.1:42123", "X-Forwarded-For", "20.20.20.20, 30.30.30.30, 192.168.1.1", "30.30.30.30"},
+		{"all trusted", "10.0.0.1:42123", "X-Forwarded-For", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"invalid hop", "10.0.0.1:42123", "X-Forwarded-For", "unknown, 10.0.0.2", "10.0.0.2"},
+		{"real ip", "10.0.0.1:42123", "X-Real-IP", " 50.50.50.50  ", "50.50.50.50"},
+		{"forwarded", "10.0.0.1:42123", "Forwarded", `for=60.60.60.60;proto=https, for="[2001:db8::1]:4711"`, "60.60.60.60"},
+		{"forwarded ipv6", "[2001:db8::2]:42123", "Forwarded", `for="[2001:db9::1]:4711"`, "2001:db9::1"},
+		{"no header", "40.40.40.40:42123", "", "", "40.40.40.40"},
+	}
+
+	for _, tc := range testCases {
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		c.Request.RemoteAddr = tc.remoteAddr
+		if len(tc.header) > 0 {
+			c.Request.Header.Set(tc.header, tc.value)
+		}
+
+		assert.Equal(t, tc.expected, c.ClientIP(), tc.name)
+	}
+}
 
-	c.Request.RemoteAddr = "  40.40.40.40:42123 "
-	assert.Equal(t, "40.40.40.40", c.ClientIP())
+func TestContextSchemeAndHost(t *testing.T) {
+	c, _, s := createTestContext()
+	s.TrustedProxies = []string{"10.0.0.0/8"}
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		scheme     string
+		host       string
+	}{
+		{"untrusted remote", "40.40.40.40:42123", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"}, "http", "example.com"},
+		{"trusted remote", "10.0.0.1:42123", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.com"}, "https", "api.example.com"},
+		{"spoofed", "10.0.0.1:42123", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.com, example.com"}, "http", "example.com"},
+		{"spoofed hops", "10.0.0.1:42123", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.1.1.1", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.com, example.com"}, "http", "example.com"},
+		{"trusted hops", "10.0.0.1:42123", map[string]string{"X-Forwarded-For": "1.1.1.1, 10.0.0.2", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "api.example.com, internal"}, "https", "api.example.com"},
+		{"forwarded", "10.0.0.1:42123", map[string]string{"Forwarded": `for=1.1.1.1;proto=http;host=evil.com, for=2.2.2.2;proto=HTTPS;host="api.example.com"`}, "https", "api.example.com"},
+		{"forwarded hops", "10.0.0.1:42123", map[string]string{"Forwarded": `for=1.1.1.1;proto=https;host=api.example.com, for=10.0.0.2;proto=http`}, "https", "api.example.com"},
+	}
+
+	for _, tc := range testCases {
+		c.Request, _ = http.NewRequest("GET", "http://example.com/", nil)
+		c.Request.RemoteAddr = tc.remoteAddr
+		for key, value := range tc.headers {
+			c.Request.Header.Set(key, value)
+		}
+
+		assert.Equal(t, tc.scheme, c.Scheme(), tc.name)
+		assert.Equal(t, tc.host, c.Host(), tc.name)
+	}
 }
 
 func TestContextContentType(t *testing.T) {
@@ -103,6 +156,34 @@ func TestContextSetGet(t *testing.T) {
 	assert.Panics(t, func() { c.MustGet("no_exist") })
 }
 
+func TestContextCopy(t *testing.T) {
+	_, _, s := createTestContext()
+
+	var cp *Context
+	s.Post("/users/:id", func(c *Context) error {
+		c.Set("foo", "bar")
+		cp = c.Copy(httptest.NewRecorder())
+		c.Set("foo", "baz")
+		return nil
+	})
+
+	req, _ := http.NewRequest("POST", "/users/1", strings.NewReader("body"))
+	type stateKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), stateKey{}, "state"))
+	s.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+	cancel()
+
+	assert.Equal(t, "1", cp.Param("id"))
+	assert.Equal(t, "bar", cp.MustGet("foo"))
+	assert.NoError(t, cp.StdContext().Err())
+	// the values of the request context belong to the original request
+	assert.Nil(t, cp.StdContext().Value(stateKey{}))
+	assert.Equal(t, http.NoBody, cp.Request.Body)
+
+	require.NoError(t, cp.String(200, "ok"))
+	assert.Equal(t, 200, cp.Writer.Status())
+}
+
 func TestContextSetGetValues(t *testing.T) {
 	var a interface{} = 1
 
@@ -140,3 +221,100 @@ func TestContextSetGetValues(t *testing.T) {
 // 	assert.Equal(t, "Hello NapNap", w.Body.String())
 // 	assert.Equal(t, "text/html; charset=utf-8", w.HeaderMap.Get("Content-Type"))
 // }
+
+func TestContextXML(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	type user struct {
+		Name string `xml:"name"`
+	}
+
+	_ = c.XML(201, user{Name: "john"})
+
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, xml.Header+"<user><name>john</name></user>", w.Body.String())
+}
+
+func TestContextJSONP(t *testing.T) {
+	c, w, _ := createTestContext()
+
+	_ = c.JSONP(200, "app.callback", map[string]string{"name": "john"})
+
+	assert.Equal(t, "application/javascript; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `/**/app.callback({"name":"john"});`, w.Body.String())
+
+	assert.Error(t, c.JSONP(200, "alert(1)//", nil))
+}
+
+func TestContextBlobAndStream(t *testing.T) {
+	c, w, _ := createTestContext()
+	_ = c.Blob(200, "image/png", []byte{1, 2, 3})
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, []byte{1, 2, 3}, w.Body.Bytes())
+
+	c, w, _ = createTestContext()
+	_ = c.Stream(200, "text/csv", strings.NewReader("a,b\n1,2\n"))
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "a,b\n1,2\n", w.Body.String())
+}
+
+func TestContextFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "hello.txt")
+	assert.NoError(t, os.WriteFile(filePath, []byte("hello world"), 0600))
+
+	c, w, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Range", "bytes=0-4")
+
+	assert.NoError(t, c.Attachment(filePath, "報告.txt"))
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Equal(t, "attachment; filename*=utf-8''%E5%A0%B1%E5%91%8A.txt", w.Header().Get("Content-Disposition"))
+
+	c, _, _ = createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	assert.Error(t, c.File(filepath.Join(t.TempDir(), "not_found.txt")))
+}
+
+func TestContextNegotiate(t *testing.T) {
+	data := map[string]string{"name": "john"}
+	n := Negotiation{
+		Offered: []string{MIMEJSON, MIMEXML, MIMEText},
+		XMLData: struct {
+			XMLName xml.Name `xml:"user"`
+			Name    string   `xml:"name"`
+		}{Name: "john"},
+		Data: data,
+	}
+
+	testCases := []struct {
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"", 200, "application/json; charset=utf-8"},
+		{"application/xml", 200, "application/xml; charset=utf-8"},
+		{"text/html;q=0.9, text/*;q=0.8, application/xml;q=0.5", 200, "text/plain; charset=utf-8"},
+		{"application/xml;q=0.5, application/json", 200, "application/json; charset=utf-8"},
+		{"*/*", 200, "application/json; charset=utf-8"},
+	}
+
+	for _, tc := range testCases {
+		c, w, _ := createTestContext()
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("Accept", tc.accept)
+
+		assert.NoError(t, c.Negotiate(200, n))
+		assert.Equal(t, tc.code, w.Code, tc.accept)
+		assert.Equal(t, tc.contentType, w.Header().Get("Content-Type"), tc.accept)
+	}
+
+	c, _, _ := createTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Accept", "image/png")
+
+	var httpErr *HTTPError
+	assert.True(t, errors.As(c.Negotiate(200, n), &httpErr))
+	assert.Equal(t, 406, httpErr.Status)
+}
@@ -0,0 +1,152 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// HTTPError represents an error which occurred while handling a request.  The error is rendered by the
+// ErrorHandler with the status code.
+type HTTPError struct {
+	// Status is the HTTP status code
+	Status int `json:"-"`
+	// Code is an application specific error code, ex: `user_not_found`
+	Code string `json:"code,omitempty"`
+	// Message is a human readable error message
+	Message string `json:"message"`
+	// Details contains additional information of the error, ex: field errors
+	Details interface{} `json:"details,omitempty"`
+	cause   error
+}
+
+// NewHTTPError returns a HTTPError instance.  The status text is used if the message is not provided.
+func NewHTTPError(status int, message ...string) *HTTPError {
+	e := &HTTPError{
+		Status:  status,
+		Message: http.StatusText(status),
+	}
+
+	if len(message) > 0 {
+		e.Message = message[0]
+	}
+
+	return e
+}
+
+// Error returns the error message
+func (e *HTTPError) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the wrapped error
+func (e *HTTPError) Unwrap() error {
+	return e.cause
+}
+
+// WithCode sets the application specific error code
+func (e *HTTPError) WithCode(code string) *HTTPError {
+	e.Code = code
+	return e
+}
+
+// WithDetails sets the additional information of the error
+func (e *HTTPError) WithDetails(details interface{}) *HTTPError {
+	e.Details = details
+	return e
+}
+
+// Wrap saves the cause of the error.  The cause is never sent to the client.
+func (e *HTTPError) Wrap(err error) *HTTPError {
+	e.cause = err
+	return e
+}
+
+// problemDetails is the error format which is defined in RFC 7807
+type problemDetails struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     string      `json:"code,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+// DefaultErrorHandler renders the error as json, ex: {"code": "user_not_found", "message": "user was not found"}.
+// `HTTPError` is rendered with its status code, `ValidationErrors` is rendered as 400 and unknown errors are rendered as 500.
+func DefaultErrorHandler(c *Context, err error) {
+	httpErr := ToHTTPError(err)
+
+	if c.Writer.Written() {
+		_logger.debugf("web: the response was already written, error: %v", err)
+		return
+	}
+
+	if c.Request.Method == HEAD {
+		c.SetStatus(httpErr.Status)
+		return
+	}
+
+	_ = c.JSON(httpErr.Status, httpErr)
+}
+
+// ProblemDetailsErrorHandler renders the error as `application/problem+json` which is defined in RFC 7807.
+func ProblemDetailsErrorHandler(c *Context, err error) {
+	httpErr := ToHTTPError(err)
+
+	if c.Writer.Written() {
+		_logger.debugf("web: the response was already written, error: %v", err)
+		return
+	}
+
+	if c.Request.Method == HEAD {
+		c.SetStatus(httpErr.Status)
+		return
+	}
+
+	problem := problemDetails{
+		Type:     "about:blank",
+		Title:    http.StatusText(httpErr.Status),
+		Status:   httpErr.Status,
+		Instance: c.Request.URL.Path,
+		Code:     httpErr.Code,
+		Details:  httpErr.Details,
+	}
+
+	if httpErr.Message != problem.Title {
+		problem.Detail = httpErr.Message
+	}
+
+	b, err := json.Marshal(problem)
+	if err != nil {
+		_logger.debugf("web: marshal problem details failed: %v", err)
+		return
+	}
+
+	_ = c.Blob(httpErr.Status, "application/problem+json; charset=utf-8", b)
+}
+
+// ToHTTPError converts the error to HTTPError.  The message of unknown error is hidden, so the internal
+// information won't be leaked to the client.
+func ToHTTPError(err error) *HTTPError {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	var validationErrs ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return NewHTTPError(http.StatusBadRequest).WithCode("validation_failed").WithDetails(validationErrs).Wrap(err)
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge).Wrap(err)
+	}
+
+	return NewHTTPError(http.StatusInternalServerError).Wrap(err)
+}
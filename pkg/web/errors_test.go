@@ -0,0 +1,102 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultErrorHandler(t *testing.T) {
+	_, _, s := createTestContext()
+
+	s.Get("/http_error", func(c *Context) error {
+		return NewHTTPError(404, "user was not found").WithCode("user_not_found")
+	})
+	s.Get("/wrapped", func(c *Context) error {
+		return fmt.Errorf("service: %w", NewHTTPError(409))
+	})
+	s.Get("/unknown", func(c *Context) error {
+		return errors.New("database password was wrong")
+	})
+	s.Get("/file", func(c *Context) error {
+		return c.File("not_exist.txt")
+	})
+	s.Get("/not_exist", func(c *Context) error {
+		return fmt.Errorf("config: %w", os.ErrNotExist)
+	})
+	s.Post("/bind", func(c *Context) error {
+		var req struct {
+			Name string `json:"name" validate:"required"`
+		}
+		return c.Bind(&req)
+	})
+
+	testCases := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/http_error", 404, `{"code":"user_not_found","message":"user was not found"}`},
+		{"GET", "/wrapped", 409, `{"message":"Conflict"}`},
+		{"GET", "/unknown", 500, `{"message":"Internal Server Error"}`},
+		{"GET", "/file", 404, `{"message":"Not Found"}`},
+		{"GET", "/not_exist", 500, `{"message":"Internal Server Error"}`},
+		{"POST", "/bind", 400, `{"code":"validation_failed","message":"Bad Request","details":[{"field":"name","rule":"required","message":"name is required"}]}`},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		s.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.path)
+		assert.Equal(t, tc.body, w.Body.String(), tc.path)
+	}
+}
+
+func TestDefaultErrorHandlerAfterWritten(t *testing.T) {
+	_, w, s := createTestContext()
+
+	s.Get("/", func(c *Context) error {
+		_ = c.String(201, "created")
+		return errors.New("oops")
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+}
+
+func TestProblemDetailsErrorHandler(t *testing.T) {
+	_, w, s := createTestContext()
+	s.ErrorHandler = ProblemDetailsErrorHandler
+
+	s.Get("/users/:id", func(c *Context) error {
+		return NewHTTPError(404, "user was not found").Wrap(os.ErrNotExist)
+	})
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	s.ServeHTTP(w, req)
+
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "application/problem+json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"user was not found","instance":"/users/1"}`, w.Body.String())
+}
+
+func TestHTTPError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := NewHTTPError(503).Wrap(cause)
+
+	assert.Equal(t, "Service Unavailable: connection refused", err.Error())
+	assert.True(t, errors.Is(err, cause))
+}
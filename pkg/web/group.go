@@ -0,0 +1,119 @@
+package web
+
+import (
+	"path"
+)
+
+// RouterGroup is used to register routes which share a common path prefix and middleware.
+// The group middleware are only executed for routes registered through the group.
+type RouterGroup struct {
+	router   *router
+	prefix   string
+	handlers []MiddlewareHandler
+}
+
+// Group creates a new router group. All routes registered through the group will be prefixed with `prefix`
+// and wrapped by `mws`.
+func (s *WebServer) Group(prefix string, mws ...MiddlewareHandler) *RouterGroup {
+	return newRouterGroup(s.router, prefix, mws)
+}
+
+func newRouterGroup(r *router, prefix string, mws []MiddlewareHandler) *RouterGroup {
+	if len(prefix) > 0 && prefix[0] != '/' {
+		panic("router: group prefix was invalid")
+	}
+
+	handlers := make([]MiddlewareHandler, len(mws))
+	copy(handlers, mws)
+
+	return &RouterGroup{
+		router:   r,
+		prefix:   prefix,
+		handlers: handlers,
+	}
+}
+
+// Group creates a nested router group. The nested group inherits the prefix and middleware of the parent group.
+func (g *RouterGroup) Group(prefix string, mws ...MiddlewareHandler) *RouterGroup {
+	handlers := make([]MiddlewareHandler, 0, len(g.handlers)+len(mws))
+	handlers = append(handlers, g.handlers...)
+	handlers = append(handlers, mws...)
+
+	return newRouterGroup(g.router, joinPaths(g.prefix, prefix), handlers)
+}
+
+// Prefix returns the path prefix of the group
+func (g *RouterGroup) Prefix() string {
+	return g.prefix
+}
+
+// UseFunc adds an anonymous function onto the group middleware stack.
+func (g *RouterGroup) UseFunc(aFunc func(c *Context, next HandlerFunc)) {
+	g.Use(MiddlewareFunc(aFunc))
+}
+
+// Use adds middleware onto the group middleware stack.  Only routes which are registered after
+// the middleware was added will be affected.
+func (g *RouterGroup) Use(mws ...MiddlewareHandler) {
+	g.handlers = append(g.handlers, mws...)
+}
+
+// Add function which adding path and handler to the group.  The group middleware are executed before the
+// route middleware `mws`.
+func (g *RouterGroup) Add(method string, path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	handlers := make([]MiddlewareHandler, 0, len(g.handlers)+len(mws))
+	handlers = append(handlers, g.handlers...)
+	handlers = append(handlers, mws...)
+
+	return g.router.Add(method, joinPaths(g.prefix, path), handler, handlers...)
+}
+
+// All is a shortcut for adding all methods
+func (g *RouterGroup) All(path string, handler HandlerFunc, mws ...MiddlewareHandler) {
+	g.Add(GET, path, handler, mws...)
+	g.Add(POST, path, handler, mws...)
+	g.Add(PUT, path, handler, mws...)
+	g.Add(DELETE, path, handler, mws...)
+	g.Add(PATCH, path, handler, mws...)
+	g.Add(OPTIONS, path, handler, mws...)
+	g.Add(HEAD, path, handler, mws...)
+}
+
+// Get is a shortcut for group.Add("GET", path, handle)
+func (g *RouterGroup) Get(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return g.Add(GET, path, handler, mws...)
+}
+
+// Post is a shortcut for group.Add("POST", path, handle)
+func (g *RouterGroup) Post(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return g.Add(POST, path, handler, mws...)
+}
+
+// Put is a shortcut for group.Add("PUT", path, handle)
+func (g *RouterGroup) Put(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return g.Add(PUT, path, handler, mws...)
+}
+
+// Delete is a shortcut for group.Add("DELETE", path, handle)
+func (g *RouterGroup) Delete(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return g.Add(DELETE, path, handler, mws...)
+}
+
+// Patch is a shortcut for group.Add("PATCH", path, handle)
+func (g *RouterGroup) Patch(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return g.Add(PATCH, path, handler, mws...)
+}
+
+// Options is a shortcut for group.Add("OPTIONS", path, handle)
+func (g *RouterGroup) Options(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return g.Add(OPTIONS, path, handler, mws...)
+}
+
+// Head is a shortcut for group.Add("HEAD", path, handle)
+func (g *RouterGroup) Head(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return g.Add(HEAD, path, handler, mws...)
+}
+
+func joinPaths(prefix string, relativePath string) string {
+	return path.Join("/", prefix, relativePath)
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterGroup(t *testing.T) {
+	_, _, s := createTestContext()
+
+	var steps []string
+
+	admin := s.Group("/admin", MiddlewareFunc(func(c *Context, next HandlerFunc) {
+		steps = append(steps, "admin")
+		_ = next(c)
+	}))
+
+	admin.Get("/users/:id", func(c *Context) error {
+		steps = append(steps, "handler:"+c.Param("id"))
+		return c.String(200, "ok")
+	})
+
+	s.Get("/public", func(c *Context) error {
+		steps = append(steps, "public")
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/users/123", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, []string{"admin", "handler:123"}, steps)
+
+	steps = nil
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/public", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, []string{"public"}, steps)
+}
+
+func TestRouterGroupNested(t *testing.T) {
+	_, _, s := createTestContext()
+
+	var steps []string
+
+	api := s.Group("/api", MiddlewareFunc(func(c *Context, next HandlerFunc) {
+		steps = append(steps, "api")
+		_ = next(c)
+	}))
+
+	v1 := api.Group("/v1")
+	v1.UseFunc(func(c *Context, next HandlerFunc) {
+		steps = append(steps, "v1")
+		_ = next(c)
+	})
+
+	v1.Get("/", func(c *Context) error {
+		steps = append(steps, "index")
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, []string{"api", "v1", "index"}, steps)
+}
+
+func TestRouterGroupAbort(t *testing.T) {
+	_, _, s := createTestContext()
+
+	isCalled := false
+
+	admin := s.Group("/admin", MiddlewareFunc(func(c *Context, next HandlerFunc) {
+		_ = c.String(401, "unauthorized")
+	}))
+
+	admin.Get("/dashboard", func(c *Context) error {
+		isCalled = true
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.False(t, isCalled)
+}
+
+func TestJoinPaths(t *testing.T) {
+	assert.Equal(t, "/", joinPaths("", ""))
+	assert.Equal(t, "/admin", joinPaths("/admin", "/"))
+	assert.Equal(t, "/admin/users/:id", joinPaths("/admin/", "users/:id"))
+	assert.Equal(t, "/admin/files/*path", joinPaths("/admin", "/files/*path"))
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+const (
+	headerRequestID = "X-Request-Id"
+)
+
+// AccessLogOptions is a configuration container to setup the access log middleware.
+type AccessLogOptions struct {
+	// SkipPaths is a list of request paths which won't be logged, ex: /health
+	SkipPaths []string
+	// SampleRate is the ratio of successful requests which will be logged.  The value is between 0 and 1 and
+	// the default value is 1.  Requests with status code 400 or above are always logged.
+	SampleRate float64
+}
+
+// AccessLog is a middleware which logs every request with the same structured fields.  The log level is
+// error for 5xx status code, warn for 4xx status code, otherwise info.
+type AccessLog struct {
+	logger     *log.Logger
+	skipPaths  map[string]bool
+	sampleRate float64
+}
+
+// NewAccessLog returns AccessLog middleware instance.  The default logger of log package is used if the logger is nil.
+func NewAccessLog(logger *log.Logger, options AccessLogOptions) *AccessLog {
+	m := &AccessLog{
+		logger:     logger,
+		skipPaths:  make(map[string]bool, len(options.SkipPaths)),
+		sampleRate: options.SampleRate,
+	}
+
+	for _, path := range options.SkipPaths {
+		m.skipPaths[strings.ToLower(path)] = true
+	}
+
+	if m.sampleRate <= 0 || m.sampleRate > 1 {
+		m.sampleRate = 1
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *AccessLog) Invoke(c *web.Context, next web.HandlerFunc) {
+	path := c.Request.URL.Path
+	if m.skipPaths[strings.ToLower(path)] {
+		_ = next(c)
+		return
+	}
+
+	start := time.Now()
+	method := c.Request.Method
+
+	_ = next(c)
+
+	status := c.Writer.Status()
+
+	if status < 400 && m.sampleRate < 1 && rand.Float64() >= m.sampleRate { //nolint:gosec
+		return
+	}
+
+	logger := m.logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	var entry *log.Entry
+
+	switch {
+	case status >= 500:
+		entry = logger.ErrorCtx(c.StdContext())
+	case status >= 400:
+		entry = logger.WarnCtx(c.StdContext())
+	default:
+		entry = logger.InfoCtx(c.StdContext())
+	}
+
+	bytes := c.Writer.ContentLength()
+	if bytes < 0 {
+		bytes = 0
+	}
+
+	entry.Str("method", method).
+		Str("path", path).
+		Str("route", c.RoutePath()).
+		Int("status", status).
+		Int("bytes", bytes).
+		Duration("latency", time.Since(start)).
+		Str("client_ip", c.ClientIP()).
+		Str("user_agent", c.Request.UserAgent()).
+		Str("request_id", requestID(c)).
+		Msg("access")
+}
+
+func requestID(c *web.Context) string {
+	if id := GetRequestID(c); len(id) > 0 {
+		return id
+	}
+
+	if id := c.Writer.Header().Get(headerRequestID); len(id) > 0 {
+		return id
+	}
+	return c.RequestHeader(headerRequestID)
+}
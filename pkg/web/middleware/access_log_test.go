@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := log.New(log.NewJSONHandler(buf, &log.HandlerOptions{Level: log.DebugLevel}))
+
+	s := web.NewServer()
+	s.Use(NewAccessLog(logger, AccessLogOptions{SkipPaths: []string{"/health"}}))
+
+	s.Get("/users/:id", func(c *web.Context) error {
+		return c.String(200, "hello")
+	})
+	s.Get("/health", func(c *web.Context) error {
+		return c.String(200, "OK")
+	})
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("User-Agent", "blackbear")
+	req.Header.Set("X-Request-Id", "abc")
+	req.RemoteAddr = "10.0.0.1:1234"
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/health", nil)
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1)
+
+	var result map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &result))
+	assert.Equal(t, "INFO", result["level"])
+	assert.Equal(t, "access", result["msg"])
+	assert.Equal(t, "GET", result["method"])
+	assert.Equal(t, "/users/1", result["path"])
+	assert.Equal(t, "/users/:id", result["route"])
+	assert.Equal(t, float64(200), result["status"])
+	assert.Equal(t, float64(5), result["bytes"])
+	assert.Equal(t, "10.0.0.1", result["client_ip"])
+	assert.Equal(t, "blackbear", result["user_agent"])
+	assert.Equal(t, "abc", result["request_id"])
+	assert.Contains(t, result, "latency")
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := log.New(log.NewJSONHandler(buf, &log.HandlerOptions{Level: log.DebugLevel}))
+
+	s := web.NewServer()
+	s.Use(NewAccessLog(logger, AccessLogOptions{SampleRate: 0.000001}))
+
+	s.Get("/ok", func(c *web.Context) error {
+		return c.String(200, "ok")
+	})
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("GET", "/ok", nil)
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// error responses are always logged
+	req, _ := http.NewRequest("GET", "/not_found", nil)
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"status":404`)
+	assert.Contains(t, lines[0], `"level":"WARN"`)
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+const (
+	// BasicAuthUserKey is the key which is used to save the authenticated user name in `web.Context`
+	BasicAuthUserKey = "user"
+	// APIKeyKey is the key which is used to save the authenticated api key in `web.Context`
+	APIKeyKey = "api_key"
+)
+
+// BasicAuthOptions is a configuration container to setup the basic auth middleware.
+type BasicAuthOptions struct {
+	// Realm is the realm of the `WWW-Authenticate` header.  Default value is "Restricted"
+	Realm string
+	// Validator returns true if the user and password are valid.  `SecureCompare` is recommended to compare
+	// the password.
+	Validator func(c *web.Context, user string, password string) bool
+}
+
+// BasicAuth is a middleware which authenticates the request by HTTP basic authentication.  The user name is saved
+// in `web.Context` with `BasicAuthUserKey` key.
+type BasicAuth struct {
+	realm     string
+	validator func(c *web.Context, user string, password string) bool
+}
+
+// NewBasicAuth returns BasicAuth middleware instance
+func NewBasicAuth(options BasicAuthOptions) *BasicAuth {
+	if options.Validator == nil {
+		panic("middleware: basic auth validator can't be nil")
+	}
+
+	m := &BasicAuth{
+		realm:     options.Realm,
+		validator: options.Validator,
+	}
+
+	if len(m.realm) == 0 {
+		m.realm = "Restricted"
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *BasicAuth) Invoke(c *web.Context, next web.HandlerFunc) {
+	user, password, ok := c.Request.BasicAuth()
+	if !ok || !m.validator(c, user, password) {
+		c.RespHeader("WWW-Authenticate", "Basic realm="+strconv.Quote(m.realm))
+		handleError(c, web.NewHTTPError(http.StatusUnauthorized))
+		return
+	}
+
+	c.Set(BasicAuthUserKey, user)
+	_ = next(c)
+}
+
+// APIKeyOptions is a configuration container to setup the api key middleware.
+type APIKeyOptions struct {
+	// Header is the request header which contains the api key.  Default value is "X-API-Key"
+	Header string
+	// Query is the query parameter which contains the api key.  It is only used when the header doesn't exist.
+	Query string
+	// Validator returns true if the api key is valid.  `SecureCompare` is recommended to compare the key.
+	Validator func(c *web.Context, key string) bool
+}
+
+// APIKey is a middleware which authenticates the request by api key.  The api key is saved in `web.Context`
+// with `APIKeyKey` key.
+type APIKey struct {
+	header    string
+	query     string
+	validator func(c *web.Context, key string) bool
+}
+
+// NewAPIKey returns APIKey middleware instance
+func NewAPIKey(options APIKeyOptions) *APIKey {
+	if options.Validator == nil {
+		panic("middleware: api key validator can't be nil")
+	}
+
+	m := &APIKey{
+		header:    options.Header,
+		query:     options.Query,
+		validator: options.Validator,
+	}
+
+	if len(m.header) == 0 {
+		m.header = "X-API-Key"
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *APIKey) Invoke(c *web.Context, next web.HandlerFunc) {
+	key := c.RequestHeader(m.header)
+	if len(key) == 0 && len(m.query) > 0 {
+		key = c.Query(m.query)
+	}
+
+	if len(key) == 0 || !m.validator(c, key) {
+		handleError(c, web.NewHTTPError(http.StatusUnauthorized))
+		return
+	}
+
+	c.Set(APIKeyKey, key)
+	_ = next(c)
+}
+
+// SecureCompare compares two strings in constant time, so it is safe to compare secrets
+func SecureCompare(given string, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(actual)) == 1
+}
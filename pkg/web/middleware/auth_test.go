@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicAuth(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewBasicAuth(BasicAuthOptions{
+		Realm: "admin",
+		Validator: func(c *web.Context, user string, password string) bool {
+			return user == "john" && SecureCompare(password, "secret")
+		},
+	}))
+
+	s.Get("/", func(c *web.Context) error {
+		user, _ := c.Get(BasicAuthUserKey)
+		return c.String(200, user.(string))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("john", "secret")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "john", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("john", "wrong")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `Basic realm="admin"`, w.Header().Get("WWW-Authenticate"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestAPIKey(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewAPIKey(APIKeyOptions{
+		Query: "api_key",
+		Validator: func(c *web.Context, key string) bool {
+			return SecureCompare(key, "key1")
+		},
+	}))
+
+	s.Get("/", func(c *web.Context) error {
+		key, _ := c.Get(APIKeyKey)
+		return c.String(200, key.(string))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "key1")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "key1", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?api_key=key1", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?api_key=key2", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `{"message":"Unauthorized"}`, w.Body.String())
+}
@@ -0,0 +1,552 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+// These compression constants are copied from the compress/gzip package.
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerContentEncoding = "Content-Encoding"
+	headerContentLength   = "Content-Length"
+	headerContentType     = "Content-Type"
+	headerVary            = "Vary"
+	headerSecWebSocketKey = "Sec-WebSocket-Key"
+
+	BestCompression    = gzip.BestCompression
+	BestSpeed          = gzip.BestSpeed
+	DefaultCompression = gzip.DefaultCompression
+	NoCompression      = gzip.NoCompression
+
+	defaultCompressMinLength   = 1024
+	defaultMaxDecompressedSize = 10 << 20 // 10MB
+)
+
+// DefaultExcludedContentTypes are the content types which are already compressed.  The type which ends with "/"
+// is matched by prefix.
+var DefaultExcludedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/zstd",
+	"application/pdf",
+}
+
+// CompressOptions is a configuration container to setup the compression middleware.
+type CompressOptions struct {
+	// Level is the compression level of gzip and deflate.  Default value is DefaultCompression, so zero value
+	// isn't NoCompression.
+	Level int
+	// MinLength is the minimum size of the response body to be compressed.  Default value is 1024.
+	MinLength int
+	// Encodings are the supported encodings in order of server preference.  Default value is gzip and deflate.
+	Encodings []string
+	// ExcludedContentTypes are the content types which won't be compressed.  Default value is
+	// `DefaultExcludedContentTypes`, except "image/svg+xml" is always compressed.
+	ExcludedContentTypes []string
+	// DecompressRequest decompresses the request body which is encoded by gzip or deflate
+	DecompressRequest bool
+	// MaxDecompressedSize is the maximum size of the decompressed request body.  The smaller one of it and
+	// `Context.MaxRequestBodySize` is used, so a small request can't expand to a huge body even if the request
+	// body isn't limited.  Default value is 10MB.
+	MaxDecompressedSize int64
+	// levelSet keeps zero Level as NoCompression, ex: `NewGzip(NoCompression)`
+	levelSet bool
+}
+
+// Compress is a middleware which compresses the response body by the encoding which is negotiated by
+// `Accept-Encoding` request header.  The first bytes of the body are buffered to decide whether the response
+// is compressed, so small responses and already compressed content types are sent as they are.
+type Compress struct {
+	level               int
+	minLength           int
+	encodings           []string
+	excluded            []string
+	decompressRequest   bool
+	maxDecompressedSize int64
+	pools               map[string]*sync.Pool
+}
+
+// GzipMiddleware is the compression middleware which only supports gzip encoding.
+//
+// Deprecated: use Compress instead.
+type GzipMiddleware = Compress
+
+// NewGzip returns a middleware which will handle the Gzip compression in Invoke.
+// Valid values for level are identical to those in the compress/gzip package.
+//
+// Deprecated: use NewCompress instead.
+func NewGzip(level int) *GzipMiddleware {
+	return NewCompress(CompressOptions{
+		Level:     level,
+		Encodings: []string{encodingGzip},
+		levelSet:  true,
+	})
+}
+
+// NewCompress returns Compress middleware instance
+func NewCompress(options CompressOptions) *Compress {
+	m := &Compress{
+		level:               options.Level,
+		minLength:           options.MinLength,
+		encodings:           options.Encodings,
+		excluded:            options.ExcludedContentTypes,
+		decompressRequest:   options.DecompressRequest,
+		maxDecompressedSize: options.MaxDecompressedSize,
+		pools:               map[string]*sync.Pool{},
+	}
+
+	if m.level == 0 && !options.levelSet {
+		m.level = DefaultCompression
+	}
+
+	if m.minLength <= 0 {
+		m.minLength = defaultCompressMinLength
+	}
+
+	if m.maxDecompressedSize <= 0 {
+		m.maxDecompressedSize = defaultMaxDecompressedSize
+	}
+
+	if len(m.encodings) == 0 {
+		m.encodings = []string{encodingGzip, encodingDeflate}
+	}
+
+	if m.excluded == nil {
+		m.excluded = DefaultExcludedContentTypes
+	}
+
+	if _, err := gzip.NewWriterLevel(io.Discard, m.level); err != nil {
+		panic(err)
+	}
+
+	for _, encoding := range m.encodings {
+		switch encoding {
+		case encodingGzip:
+			m.pools[encoding] = &sync.Pool{
+				New: func() interface{} {
+					gz, _ := gzip.NewWriterLevel(io.Discard, m.level)
+					return gz
+				},
+			}
+		case encodingDeflate:
+			m.pools[encoding] = &sync.Pool{
+				New: func() interface{} {
+					zw, _ := zlib.NewWriterLevel(io.Discard, m.level)
+					return zw
+				},
+			}
+		default:
+			panic("middleware: compress encoding '" + encoding + "' is not supported")
+		}
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *Compress) Invoke(c *web.Context, next web.HandlerFunc) {
+	if m.decompressRequest {
+		if err := m.decompressBody(c); err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	// Skip compression if client attempt WebSocket connection
+	if len(c.RequestHeader(headerSecWebSocketKey)) > 0 {
+		_ = next(c)
+		return
+	}
+
+	addVary(c.Writer.Header(), headerAcceptEncoding)
+
+	encoding := m.negotiate(c.RequestHeader(headerAcceptEncoding))
+	if len(encoding) == 0 {
+		_ = next(c)
+		return
+	}
+
+	w := c.Writer
+	cw := &compressWriter{
+		ResponseWriter: w,
+		m:              m,
+		encoding:       encoding,
+		status:         http.StatusOK,
+		head:           c.Request.Method == http.MethodHead,
+	}
+
+	c.Writer = cw
+
+	completed := false
+	defer func() {
+		// the buffered body is discarded when the handler panics, so the recovery middleware is able to write
+		// the error response by the original writer
+		if !completed {
+			c.Writer = w
+		}
+	}()
+
+	_ = next(c)
+	completed = true
+
+	cw.close()
+	c.Writer = w
+}
+
+// negotiate returns the encoding which has the highest q-value.  The server preference is used if the q-values
+// are the same.
+func (m *Compress) negotiate(acceptEncoding string) string {
+	if len(acceptEncoding) == 0 {
+		return ""
+	}
+
+	qvalues := map[string]float64{}
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if name == "x-gzip" {
+			name = encodingGzip
+		}
+
+		qvalues[name] = q
+	}
+
+	best, bestQ := "", 0.0
+
+	for _, encoding := range m.encodings {
+		q, found := qvalues[encoding]
+		if !found {
+			q, found = qvalues["*"]
+		}
+
+		if found && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+func (m *Compress) isExcluded(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if mediaType == "image/svg+xml" {
+		return false
+	}
+
+	for _, excluded := range m.excluded {
+		if strings.HasSuffix(excluded, "/") {
+			if strings.HasPrefix(mediaType, excluded) {
+				return true
+			}
+			continue
+		}
+
+		if mediaType == excluded {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Compress) decompressBody(c *web.Context) error {
+	req := c.Request
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+
+	switch strings.ToLower(req.Header.Get(headerContentEncoding)) {
+	case encodingGzip, "x-gzip":
+		reader, err = gzip.NewReader(req.Body)
+	case encodingDeflate:
+		reader, err = zlib.NewReader(req.Body)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return web.NewHTTPError(http.StatusBadRequest, "request body can't be decompressed").Wrap(err)
+	}
+
+	// the decompressed body is limited as well.  The limit is checked on every read, because it can be changed by
+	// the route middleware, ex: Timeout.
+	req.Body = &decompressReader{
+		ReadCloser: reader,
+		body:       req.Body,
+		limit: func() int64 {
+			return min(c.MaxRequestBodySize(), m.maxDecompressedSize)
+		},
+	}
+	req.Header.Del(headerContentEncoding)
+	req.Header.Del(headerContentLength)
+	req.ContentLength = -1
+
+	return nil
+}
+
+type decompressReader struct {
+	io.ReadCloser
+	body  io.ReadCloser
+	limit func() int64
+	read  int64
+}
+
+// Read returns http.MaxBytesError if the decompressed body exceeds the limit
+func (r *decompressReader) Read(p []byte) (int, error) {
+	limit := r.limit()
+
+	remaining := limit - r.read
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// read one more byte to know whether the limit is exceeded
+	if int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	if int64(n) > remaining {
+		r.read += remaining
+		return int(remaining), &http.MaxBytesError{Limit: limit}
+	}
+
+	r.read += int64(n)
+	return n, err
+}
+
+func (r *decompressReader) Close() error {
+	_ = r.ReadCloser.Close()
+	return r.body.Close()
+}
+
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values(headerVary) {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, value) {
+				return
+			}
+		}
+	}
+	header.Add(headerVary, value)
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter buffers the first bytes of the body to decide whether the response is compressed
+type compressWriter struct {
+	web.ResponseWriter
+	m             *Compress
+	encoding      string
+	status        int
+	headerWritten bool
+	decided       bool
+	enc           encoder
+	buf           []byte
+	// head is true for HEAD requests, the header is the same as GET but the body is discarded
+	head    bool
+	discard bool
+}
+
+// WriteHeader saves the status code, the header is written after the response is decided to be compressed or not
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.headerWritten || cw.ResponseWriter.Written() {
+		return
+	}
+
+	cw.status = statusCode
+	cw.headerWritten = true
+
+	// the responses don't have a body
+	if statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.headerWritten {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+
+		if len(cw.buf) < cw.m.minLength {
+			return len(b), nil
+		}
+
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+
+		return len(b), nil
+	}
+
+	return cw.write(b)
+}
+
+func (cw *compressWriter) write(b []byte) (int, error) {
+	if cw.discard {
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide writes the header.  The response is compressed if it is large enough, the content type is compressible
+// and the response was not encoded by the handler.
+func (cw *compressWriter) decide(largeEnough bool) error {
+	cw.decided = true
+
+	header := cw.Header()
+
+	if len(header.Get(headerContentType)) == 0 && len(cw.buf) > 0 {
+		header.Set(headerContentType, http.DetectContentType(cw.buf))
+	}
+
+	compress := largeEnough &&
+		cw.status != http.StatusPartialContent &&
+		len(header.Get(headerContentEncoding)) == 0 &&
+		len(header.Get("Content-Range")) == 0 &&
+		!cw.m.isExcluded(header.Get(headerContentType))
+
+	if compress {
+		header.Set(headerContentEncoding, cw.encoding)
+		header.Del(headerContentLength)
+
+		if cw.head {
+			cw.discard = true
+		} else {
+			cw.enc, _ = cw.m.pools[cw.encoding].Get().(encoder)
+			cw.enc.Reset(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) > 0 {
+		buf := cw.buf
+		cw.buf = nil
+
+		if _, err := cw.write(buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status returns http status code
+func (cw *compressWriter) Status() int {
+	if cw.ResponseWriter.Written() {
+		return cw.ResponseWriter.Status()
+	}
+	return cw.status
+}
+
+// Written returns true if the response header has been written
+func (cw *compressWriter) Written() bool {
+	return cw.headerWritten || cw.ResponseWriter.Written()
+}
+
+// Flush flushes the buffered data to the client, so streaming responses, ex: server-sent events, are compressed
+// regardless of the minimum length.
+func (cw *compressWriter) Flush() {
+	if !cw.headerWritten {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+
+	cw.ResponseWriter.Flush()
+}
+
+// Unwrap returns the wrapped writer, so http.NewResponseController is able to find the optional interfaces
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Push implements the http.Pusher interface
+func (cw *compressWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := cw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+func (cw *compressWriter) contentLength() int64 {
+	length, err := strconv.ParseInt(cw.Header().Get(headerContentLength), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return length
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.headerWritten {
+		// the body is smaller than the minimum length.  The handler of HEAD request may only set Content-Length,
+		// ex: http.ServeContent, so it is used to decide the same as GET.
+		_ = cw.decide(cw.head && len(cw.buf) == 0 && cw.contentLength() >= int64(cw.m.minLength))
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		cw.m.pools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
@@ -0,0 +1,277 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressNegotiate(t *testing.T) {
+	m := NewCompress(CompressOptions{})
+
+	assert.Equal(t, "gzip", m.negotiate("gzip, deflate, br"))
+	assert.Equal(t, "deflate", m.negotiate("gzip;q=0.5, deflate"))
+	assert.Equal(t, "gzip", m.negotiate("br, *"))
+	assert.Equal(t, "deflate", m.negotiate("gzip;q=0, *;q=0.1"))
+	assert.Equal(t, "", m.negotiate("identity"))
+	assert.Equal(t, "", m.negotiate(""))
+}
+
+func TestCompressLevel(t *testing.T) {
+	assert.Equal(t, DefaultCompression, NewCompress(CompressOptions{}).level)
+	assert.Equal(t, BestSpeed, NewCompress(CompressOptions{Level: BestSpeed}).level)
+
+	// the deprecated constructor keeps zero level as NoCompression
+	m := NewGzip(NoCompression)
+	assert.Equal(t, NoCompression, m.level)
+
+	large := strings.Repeat("hello world ", 200)
+
+	s := web.NewServer()
+	s.Use(m)
+	s.Get("/", func(c *web.Context) error {
+		return c.String(200, large)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	// the body is stored without compression
+	assert.Greater(t, w.Body.Len(), len(large))
+}
+
+func TestCompressPolicy(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+
+	s := web.NewServer()
+	s.Use(NewCompress(CompressOptions{}))
+	largeHandler := func(c *web.Context) error {
+		c.RespHeader("Content-Length", "2400")
+		return c.String(200, large)
+	}
+	s.Get("/large", largeHandler)
+	s.Head("/large", largeHandler)
+	s.Head("/length_only", func(c *web.Context) error {
+		c.RespHeader("Content-Type", "text/plain; charset=utf-8")
+		c.RespHeader("Content-Length", "2400")
+		c.SetStatus(200)
+		return nil
+	})
+	s.Get("/small", func(c *web.Context) error {
+		return c.String(200, "hello")
+	})
+	s.Get("/image", func(c *web.Context) error {
+		return c.Blob(200, "image/png", []byte(large))
+	})
+	s.Get("/not_modified", func(c *web.Context) error {
+		c.SetStatus(304)
+		return nil
+	})
+
+	testCases := []struct {
+		path       string
+		method     string
+		status     int
+		compressed bool
+	}{
+		{"/large", "GET", 200, true},
+		{"/large", "HEAD", 200, true},
+		{"/length_only", "HEAD", 200, true},
+		{"/small", "GET", 200, false},
+		{"/image", "GET", 200, false},
+		{"/not_modified", "GET", 304, false},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+		s.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code, tc.path)
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"), tc.path)
+
+		if !tc.compressed {
+			assert.Empty(t, w.Header().Get("Content-Encoding"), tc.path)
+			continue
+		}
+
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"), tc.path)
+		assert.Empty(t, w.Header().Get("Content-Length"), tc.path)
+
+		// the header of HEAD is the same as GET, but the body is discarded
+		if tc.method == "HEAD" {
+			assert.Empty(t, w.Body.String(), tc.path)
+			continue
+		}
+
+		gz, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		b, _ := io.ReadAll(gz)
+		assert.Equal(t, large, string(b))
+	}
+}
+
+func TestCompressDeflate(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+
+	s := web.NewServer()
+	s.Use(NewCompress(CompressOptions{MinLength: 10}))
+	s.Get("/", func(c *web.Context) error {
+		// the content type is detected by the first bytes
+		_, err := c.Writer.Write([]byte(large))
+		return err
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	s.ServeHTTP(w, req)
+
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+	zr, err := zlib.NewReader(w.Body)
+	require.NoError(t, err)
+	b, _ := io.ReadAll(zr)
+	assert.Equal(t, large, string(b))
+}
+
+func TestCompressFlush(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewGzip(DefaultCompression))
+	s.Get("/events", func(c *web.Context) error {
+		sse, err := c.SSE()
+		if err != nil {
+			return err
+		}
+		return sse.Send(web.SSEvent{Data: "hello"})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	b, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "data: hello\n\n", string(b))
+}
+
+func gzipBody(s string) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(s))
+	_ = gz.Close()
+	return &buf
+}
+
+func TestCompressDecompressRequest(t *testing.T) {
+	s := web.NewServer()
+	s.MaxRequestBodySize = 100
+	s.Use(NewCompress(CompressOptions{DecompressRequest: true}))
+	s.Post("/", func(c *web.Context) error {
+		b, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		return c.String(200, string(b))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", gzipBody("hello"))
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+
+	// the decompressed body is limited
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", gzipBody(strings.Repeat("a", 1000)))
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 413, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", strings.NewReader("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestCompressDecompressRequestRouteLimit(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewCompress(CompressOptions{DecompressRequest: true}))
+	s.Post("/upload", func(c *web.Context) error {
+		b, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		return c.String(200, string(b))
+	}, NewTimeout(TimeoutOptions{MaxRequestBodySize: 100}))
+
+	// the route limit keeps the decompression
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/upload", gzipBody("hello"))
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+
+	// the decompressed body is limited by the route limit
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/upload", gzipBody(strings.Repeat("a", 200)))
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 413, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("a", 200)))
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 413, w.Code)
+}
+
+func TestCompressMaxDecompressedSize(t *testing.T) {
+	s := web.NewServer()
+	s.MaxRequestBodySize = 1 << 62
+	s.Use(NewCompress(CompressOptions{DecompressRequest: true, MaxDecompressedSize: 100}))
+	s.Post("/", func(c *web.Context) error {
+		b, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		return c.String(200, string(b))
+	})
+
+	body := strings.Repeat("a", 100)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", gzipBody(body))
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, body, w.Body.String())
+
+	// the body isn't limited by the server, but the decompressed size is
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", gzipBody(strings.Repeat("a", 1<<20)))
+	req.Header.Set("Content-Encoding", "gzip")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 413, w.Code)
+}
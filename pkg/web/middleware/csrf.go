@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+const (
+	defaultCSRFCookieName = "_csrf"
+	defaultCSRFHeaderName = "X-CSRF-Token"
+	defaultCSRFFormField  = "_csrf"
+	defaultCSRFMaxAge     = 86400 // 1 day
+	csrfTokenLength       = 32
+)
+
+// DefaultCSRFSafeMethods are the methods which don't need the CSRF token
+var DefaultCSRFSafeMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}
+
+// CSRFOptions is a configuration container to setup the csrf middleware.
+type CSRFOptions struct {
+	// CookieName is the name of the cookie which saves the token.  Default value is "_csrf"
+	CookieName string
+	// CookiePath is the path of the cookie.  Default value is "/", so the token is sent to all paths.
+	CookiePath   string
+	CookieDomain string
+	// CookieMaxAge is the max age of the cookie in seconds.  Default value is 86400 (1 day)
+	CookieMaxAge int
+	// CookieSecure sends the cookie over https only.  The cookie is always secure if `Context.Scheme` is https.
+	CookieSecure   bool
+	CookieHTTPOnly bool
+	// CookieSameSite is the SameSite attribute of the cookie.  Default value is http.SameSiteLaxMode
+	CookieSameSite http.SameSite
+	// HeaderName is the request header which carries the token.  Default value is "X-CSRF-Token"
+	HeaderName string
+	// FormField is the form field which carries the token if the header is empty.  Default value is "_csrf"
+	FormField string
+	// SafeMethods are the methods which are not checked.  Default value is `DefaultCSRFSafeMethods`
+	SafeMethods []string
+}
+
+// CSRF is a middleware which protects the requests by double-submit cookies.  The token is saved in the cookie
+// and the requests of unsafe methods must send the same token by the header or the form field.  The token is
+// available to the templates by `csrfToken` function and `Context.CSRFToken`.  HTTPError with 403 status code is
+// handled by `WebServer.ErrorHandler` if the token is missing or invalid.
+type CSRF struct {
+	cookieName     string
+	cookiePath     string
+	cookieDomain   string
+	cookieMaxAge   int
+	cookieSecure   bool
+	cookieHTTPOnly bool
+	cookieSameSite http.SameSite
+	headerName     string
+	formField      string
+	safeMethods    map[string]bool
+}
+
+// NewCSRF returns CSRF middleware instance
+func NewCSRF(options CSRFOptions) *CSRF {
+	m := &CSRF{
+		cookieName:     options.CookieName,
+		cookiePath:     options.CookiePath,
+		cookieDomain:   options.CookieDomain,
+		cookieMaxAge:   options.CookieMaxAge,
+		cookieSecure:   options.CookieSecure,
+		cookieHTTPOnly: options.CookieHTTPOnly,
+		cookieSameSite: options.CookieSameSite,
+		headerName:     options.HeaderName,
+		formField:      options.FormField,
+		safeMethods:    map[string]bool{},
+	}
+
+	if len(m.cookieName) == 0 {
+		m.cookieName = defaultCSRFCookieName
+	}
+
+	if len(m.cookiePath) == 0 {
+		m.cookiePath = "/"
+	}
+
+	if m.cookieMaxAge == 0 {
+		m.cookieMaxAge = defaultCSRFMaxAge
+	}
+
+	if m.cookieSameSite == 0 {
+		m.cookieSameSite = http.SameSiteLaxMode
+	}
+
+	if len(m.headerName) == 0 {
+		m.headerName = defaultCSRFHeaderName
+	}
+
+	if len(m.formField) == 0 {
+		m.formField = defaultCSRFFormField
+	}
+
+	safeMethods := options.SafeMethods
+	if safeMethods == nil {
+		safeMethods = DefaultCSRFSafeMethods
+	}
+
+	for _, method := range safeMethods {
+		m.safeMethods[strings.ToUpper(method)] = true
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *CSRF) Invoke(c *web.Context, next web.HandlerFunc) {
+	token, err := c.Cookie(m.cookieName)
+	if err != nil || len(token) != csrfTokenLength {
+		token = ""
+	}
+
+	if !m.safeMethods[c.Request.Method] {
+		given := c.RequestHeader(m.headerName)
+		if len(given) == 0 {
+			given = c.Form(m.formField)
+		}
+
+		if len(token) == 0 || len(given) == 0 || !SecureCompare(given, token) {
+			handleError(c, web.NewHTTPError(http.StatusForbidden, "invalid csrf token").WithCode("invalid_csrf_token"))
+			return
+		}
+	}
+
+	if len(token) == 0 {
+		token = randomToken(csrfTokenLength * 3 / 4)
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     m.cookieName,
+			Value:    token,
+			MaxAge:   m.cookieMaxAge,
+			Path:     m.cookiePath,
+			Domain:   m.cookieDomain,
+			Secure:   m.cookieSecure || c.Scheme() == "https",
+			HttpOnly: m.cookieHTTPOnly,
+			SameSite: m.cookieSameSite,
+		})
+	}
+
+	c.Set(web.CSRFTokenKey, token)
+	// the response contains the token, so the shared cache must not serve it to other users
+	addVary(c.Writer.Header(), "Cookie")
+
+	_ = next(c)
+}
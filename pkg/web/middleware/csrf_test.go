@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRF(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewCSRF(CSRFOptions{CookieHTTPOnly: true}))
+	handler := func(c *web.Context) error {
+		return c.String(200, c.CSRFToken())
+	}
+	s.Get("/", handler)
+	s.Post("/", handler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, "_csrf", cookie.Name)
+	assert.Equal(t, "/", cookie.Path)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Path=/;")
+	assert.True(t, cookie.HttpOnly)
+	assert.False(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Len(t, cookie.Value, 32)
+	assert.Equal(t, cookie.Value, w.Body.String())
+
+	// the cookie is secure over https
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	s.ServeHTTP(w, req)
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.True(t, w.Result().Cookies()[0].Secure)
+
+	// the existing token is reused
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	s.ServeHTTP(w, req)
+	assert.Empty(t, w.Result().Cookies())
+	assert.Equal(t, cookie.Value, w.Body.String())
+
+	testCases := []struct {
+		name   string
+		cookie bool
+		header string
+		form   string
+		status int
+	}{
+		{"header", true, cookie.Value, "", 200},
+		{"form", true, "", cookie.Value, 200},
+		{"missing token", true, "", "", 403},
+		{"wrong token", true, strings.Repeat("a", 32), "", 403},
+		{"missing cookie", false, cookie.Value, "", 403},
+	}
+
+	for _, tc := range testCases {
+		form := url.Values{}
+		if len(tc.form) > 0 {
+			form.Set("_csrf", tc.form)
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tc.cookie {
+			req.AddCookie(cookie)
+		}
+		if len(tc.header) > 0 {
+			req.Header.Set("X-CSRF-Token", tc.header)
+		}
+		s.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code, tc.name)
+		if tc.status == 403 {
+			assert.JSONEq(t, `{"code":"invalid_csrf_token","message":"invalid csrf token"}`, w.Body.String(), tc.name)
+		}
+	}
+}
+
+func TestCSRFSafeMethods(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewCSRF(CSRFOptions{SafeMethods: []string{"GET", "POST"}}))
+	s.Post("/", func(c *web.Context) error {
+		return c.String(200, "ok")
+	})
+	s.Delete("/", func(c *web.Context) error {
+		return c.String(200, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+}
@@ -6,7 +6,9 @@ import (
 	"github.com/nite-coder/blackbear/pkg/web"
 )
 
-// Health is health middleware struct
+// Health is health middleware struct.  "/health" returns 503 status code once the server starts shutting down,
+// so the load balancer stops sending new requests.  `ServerOptions.ShutdownDelay` must be set, otherwise the server
+// stops before the load balancer observes the 503.
 type Health struct {
 }
 
@@ -18,6 +20,10 @@ func NewHealth() *Health {
 // Invoke function is a middleware entry
 func (h *Health) Invoke(c *web.Context, next web.HandlerFunc) {
 	if strings.EqualFold(c.Request.URL.Path, "/health") {
+		if !c.WebServer.IsReady() {
+			_ = c.String(503, "Service Unavailable")
+			return
+		}
 		_ = c.String(200, "OK")
 	} else {
 		_ = next(c)
@@ -0,0 +1,576 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+const (
+	// JWTClaimsKey is the key which is used to save the verified claims in `web.Context`
+	JWTClaimsKey = "jwt_claims"
+)
+
+var (
+	// ErrTokenMissing is returned when the request doesn't have a bearer token
+	ErrTokenMissing = errors.New("middleware: token is missing")
+	// ErrTokenMalformed is returned when the token can't be decoded
+	ErrTokenMalformed = errors.New("middleware: token is malformed")
+	// ErrTokenUnverifiable is returned when the algorithm is not allowed or the key was not found
+	ErrTokenUnverifiable = errors.New("middleware: token is unverifiable")
+	// ErrTokenSignatureInvalid is returned when the signature is invalid
+	ErrTokenSignatureInvalid = errors.New("middleware: token signature is invalid")
+	// ErrTokenExpired is returned when the token is expired
+	ErrTokenExpired = errors.New("middleware: token is expired")
+	// ErrTokenNotValidYet is returned when the token is used before the `nbf` claim
+	ErrTokenNotValidYet = errors.New("middleware: token is not valid yet")
+	// ErrTokenInvalidIssuer is returned when the `iss` claim doesn't match
+	ErrTokenInvalidIssuer = errors.New("middleware: token has invalid issuer")
+	// ErrTokenInvalidAudience is returned when the `aud` claim doesn't match
+	ErrTokenInvalidAudience = errors.New("middleware: token has invalid audience")
+)
+
+// JWTClaims are the claims of a verified token
+type JWTClaims map[string]interface{}
+
+// Subject returns the `sub` claim
+func (claims JWTClaims) Subject() string {
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// Issuer returns the `iss` claim
+func (claims JWTClaims) Issuer() string {
+	iss, _ := claims["iss"].(string)
+	return iss
+}
+
+// Audience returns the `aud` claim.  The claim can be a string or an array of strings.
+func (claims JWTClaims) Audience() []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		result := make([]string, 0, len(aud))
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func (claims JWTClaims) time(key string) (time.Time, bool) {
+	switch v := claims[key].(type) {
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))), true
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(f*float64(time.Second))), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// ExpiresAt returns the `exp` claim
+func (claims JWTClaims) ExpiresAt() (time.Time, bool) {
+	return claims.time("exp")
+}
+
+// NotBefore returns the `nbf` claim
+func (claims JWTClaims) NotBefore() (time.Time, bool) {
+	return claims.time("nbf")
+}
+
+// GetJWTClaims returns the claims which are saved by JWT middleware
+func GetJWTClaims(c *web.Context) (JWTClaims, bool) {
+	val, found := c.Get(JWTClaimsKey)
+	if !found {
+		return nil, false
+	}
+
+	claims, ok := val.(JWTClaims)
+	return claims, ok
+}
+
+// JWTOptions is a configuration container to setup the JWT middleware.  At least one of `Secret`, `PublicKey`
+// and `JWKS` must be provided.
+type JWTOptions struct {
+	// Secret is the key of HMAC algorithms (HS256, HS384, HS512)
+	Secret []byte
+	// PublicKey is the key of RSA (RS256, RS384, RS512) or ECDSA (ES256, ES384, ES512) algorithms.
+	// The type must be *rsa.PublicKey or *ecdsa.PublicKey.
+	PublicKey crypto.PublicKey
+	// JWKS is the key set which is loaded by `LoadJWKS`.  The key is chosen by the `kid` header of the token.
+	JWKS *JWKS
+	// Algorithms are the allowed algorithms.  Default value is all algorithms which are supported by the keys.
+	Algorithms []string
+	// Issuer is the expected `iss` claim.  The claim is not checked if it is empty.
+	Issuer string
+	// Audience is the expected `aud` claim.  The claim is not checked if it is empty.
+	Audience string
+	// Leeway is the tolerance of the clock skew when checking `exp` and `nbf` claims
+	Leeway time.Duration
+}
+
+// JWT is a middleware which verifies the bearer token of the `Authorization` header.  The verified claims are
+// saved in `web.Context` with `JWTClaimsKey` key.
+type JWT struct {
+	secret     []byte
+	publicKey  crypto.PublicKey
+	jwks       *JWKS
+	algorithms map[string]bool
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+// NewJWT returns JWT middleware instance
+func NewJWT(options JWTOptions) *JWT {
+	if len(options.Secret) == 0 && options.PublicKey == nil && options.JWKS == nil {
+		panic("middleware: jwt key can't be empty")
+	}
+
+	switch options.PublicKey.(type) {
+	case nil, *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		panic(fmt.Sprintf("middleware: jwt public key type %T is not supported", options.PublicKey))
+	}
+
+	m := &JWT{
+		secret:     options.Secret,
+		publicKey:  options.PublicKey,
+		jwks:       options.JWKS,
+		algorithms: map[string]bool{},
+		issuer:     options.Issuer,
+		audience:   options.Audience,
+		leeway:     options.Leeway,
+		now:        time.Now,
+	}
+
+	for _, alg := range options.Algorithms {
+		if _, found := jwtAlgorithms[alg]; !found {
+			panic("middleware: jwt algorithm '" + alg + "' is not supported")
+		}
+		m.algorithms[alg] = true
+	}
+
+	if len(m.algorithms) == 0 {
+		for alg := range jwtAlgorithms {
+			m.algorithms[alg] = true
+		}
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *JWT) Invoke(c *web.Context, next web.HandlerFunc) {
+	claims, err := m.Verify(bearerToken(c))
+	if err != nil {
+		c.RespHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+		handleError(c, web.NewHTTPError(http.StatusUnauthorized).WithCode("invalid_token").Wrap(err))
+		return
+	}
+
+	c.Set(JWTClaimsKey, claims)
+	_ = next(c)
+}
+
+func bearerToken(c *web.Context) string {
+	auth := c.RequestHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// Verify verifies the signature and the registered claims of the token and returns the claims
+func (m *JWT) Verify(token string) (JWTClaims, error) {
+	if len(token) == 0 {
+		return nil, ErrTokenMissing
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	alg, found := jwtAlgorithms[header.Alg]
+	if !found || !m.algorithms[header.Alg] {
+		return nil, fmt.Errorf("%w: algorithm '%s' is not allowed", ErrTokenUnverifiable, header.Alg)
+	}
+
+	key, err := m.key(header.Kid, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := alg.verify([]byte(parts[0]+"."+parts[1]), signature, key); err != nil {
+		return nil, err
+	}
+
+	var claims JWTClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if err := m.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// key returns the key of the algorithm family, so the token can't use a RSA public key as HMAC secret
+func (m *JWT) key(kid string, alg jwtAlgorithm) (interface{}, error) {
+	if m.jwks != nil {
+		if key := m.jwks.find(kid, alg.family); key != nil {
+			return key, nil
+		}
+	}
+
+	switch alg.family {
+	case "oct":
+		if len(m.secret) > 0 {
+			return m.secret, nil
+		}
+	case "RSA":
+		if key, ok := m.publicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case "EC":
+		if key, ok := m.publicKey.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: key was not found", ErrTokenUnverifiable)
+}
+
+func (m *JWT) validateClaims(claims JWTClaims) error {
+	now := m.now()
+
+	if _, found := claims["exp"]; found {
+		exp, ok := claims.ExpiresAt()
+		if !ok {
+			return ErrTokenMalformed
+		}
+
+		if !now.Before(exp.Add(m.leeway)) {
+			return ErrTokenExpired
+		}
+	}
+
+	if _, found := claims["nbf"]; found {
+		nbf, ok := claims.NotBefore()
+		if !ok {
+			return ErrTokenMalformed
+		}
+
+		if now.Add(m.leeway).Before(nbf) {
+			return ErrTokenNotValidYet
+		}
+	}
+
+	if len(m.issuer) > 0 && claims.Issuer() != m.issuer {
+		return ErrTokenInvalidIssuer
+	}
+
+	if len(m.audience) > 0 {
+		found := false
+		for _, aud := range claims.Audience() {
+			if aud == m.audience {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return ErrTokenInvalidAudience
+		}
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrTokenMalformed
+	}
+
+	return nil
+}
+
+type jwtAlgorithm struct {
+	family string
+	hash   crypto.Hash
+	// curve is the name of the elliptic curve which the ECDSA key must use
+	curve string
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"HS256": {family: "oct", hash: crypto.SHA256},
+	"HS384": {family: "oct", hash: crypto.SHA384},
+	"HS512": {family: "oct", hash: crypto.SHA512},
+	"RS256": {family: "RSA", hash: crypto.SHA256},
+	"RS384": {family: "RSA", hash: crypto.SHA384},
+	"RS512": {family: "RSA", hash: crypto.SHA512},
+	"ES256": {family: "EC", hash: crypto.SHA256, curve: "P-256"},
+	"ES384": {family: "EC", hash: crypto.SHA384, curve: "P-384"},
+	"ES512": {family: "EC", hash: crypto.SHA512, curve: "P-521"},
+}
+
+func (alg jwtAlgorithm) newHash() hash.Hash {
+	switch alg.hash { //nolint:exhaustive
+	case crypto.SHA384:
+		return sha512.New384()
+	case crypto.SHA512:
+		return sha512.New()
+	default:
+		return sha256.New()
+	}
+}
+
+func (alg jwtAlgorithm) verify(signingInput []byte, signature []byte, key interface{}) error {
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(alg.newHash, k)
+		_, _ = mac.Write(signingInput)
+
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrTokenSignatureInvalid
+		}
+	case *rsa.PublicKey:
+		h := alg.newHash()
+		_, _ = h.Write(signingInput)
+
+		if err := rsa.VerifyPKCS1v15(k, alg.hash, h.Sum(nil), signature); err != nil {
+			return ErrTokenSignatureInvalid
+		}
+	case *ecdsa.PublicKey:
+		if name := k.Curve.Params().Name; name != alg.curve {
+			return fmt.Errorf("%w: curve '%s' doesn't match the algorithm", ErrTokenUnverifiable, name)
+		}
+
+		keySize := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*keySize {
+			return ErrTokenSignatureInvalid
+		}
+
+		h := alg.newHash()
+		_, _ = h.Write(signingInput)
+
+		r := new(big.Int).SetBytes(signature[:keySize])
+		s := new(big.Int).SetBytes(signature[keySize:])
+
+		if !ecdsa.Verify(k, h.Sum(nil), r, s) {
+			return ErrTokenSignatureInvalid
+		}
+	default:
+		return ErrTokenUnverifiable
+	}
+
+	return nil
+}
+
+// JWKS is a JSON Web Key Set which contains the keys to verify the tokens
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	kty string
+	key interface{}
+}
+
+// LoadJWKS loads the JSON Web Key Set from a local file.  RSA, EC and oct keys are supported.
+func LoadJWKS(path string) (*JWKS, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parses the JSON Web Key Set
+func ParseJWKS(b []byte) (*JWKS, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("middleware: parse jwks failed: %w", err)
+	}
+
+	jwks := &JWKS{}
+
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key interface{}
+			err error
+		)
+
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k.N, k.E)
+		case "EC":
+			key, err = parseECKey(k.Crv, k.X, k.Y)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("middleware: parse jwk '%s' failed: %w", k.Kid, err)
+		}
+
+		jwks.keys = append(jwks.keys, jwk{kid: k.Kid, kty: k.Kty, key: key})
+	}
+
+	return jwks, nil
+}
+
+// find returns the key by kid.  The first key of the type is returned if the kid is empty.
+func (jwks *JWKS) find(kid string, kty string) interface{} {
+	for _, k := range jwks.keys {
+		if k.kty != kty {
+			continue
+		}
+
+		if len(kid) == 0 || k.kid == kid {
+			return k.key
+		}
+	}
+
+	return nil
+}
+
+func parseRSAKey(n string, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(eb)
+	if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nb),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+func parseECKey(crv string, x string, y string) (*ecdsa.PublicKey, error) {
+	var (
+		curve     elliptic.Curve
+		ecdhCurve ecdh.Curve
+	)
+
+	switch crv {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("curve '%s' is not supported", crv)
+	}
+
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	if len(xb) != size || len(yb) != size {
+		return nil, errors.New("invalid point size")
+	}
+
+	// make sure the point is on the curve
+	point := append([]byte{4}, xb...)
+	point = append(point, yb...)
+
+	if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(xb),
+		Y:     new(big.Int).SetBytes(yb),
+	}, nil
+}
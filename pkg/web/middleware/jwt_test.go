@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signToken(t *testing.T, header map[string]interface{}, claims map[string]interface{}, key interface{}) string {
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	p, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		_, _ = mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifyHS256(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewJWT(JWTOptions{
+		Secret:   secret,
+		Issuer:   "blackbear",
+		Audience: "api",
+		Leeway:   time.Minute,
+	})
+	m.now = func() time.Time { return now }
+
+	header := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+
+	token := signToken(t, header, map[string]interface{}{
+		"sub": "1",
+		"iss": "blackbear",
+		"aud": []string{"web", "api"},
+		"exp": now.Add(time.Hour).Unix(),
+		"nbf": now.Add(30 * time.Second).Unix(), // within leeway
+	}, secret)
+
+	claims, err := m.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "1", claims.Subject())
+	assert.Equal(t, []string{"web", "api"}, claims.Audience())
+
+	token = signToken(t, header, map[string]interface{}{"iss": "blackbear", "aud": "api", "exp": now.Add(-2 * time.Minute).Unix()}, secret)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	token = signToken(t, header, map[string]interface{}{"iss": "blackbear", "aud": "api", "nbf": now.Add(2 * time.Minute).Unix()}, secret)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenNotValidYet)
+
+	token = signToken(t, header, map[string]interface{}{"iss": "other", "aud": "api"}, secret)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenInvalidIssuer)
+
+	token = signToken(t, header, map[string]interface{}{"iss": "blackbear", "aud": "web"}, secret)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenInvalidAudience)
+
+	token = signToken(t, header, map[string]interface{}{"iss": "blackbear", "aud": "api"}, []byte("wrong"))
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenSignatureInvalid)
+
+	token = signToken(t, map[string]interface{}{"alg": "none"}, map[string]interface{}{"iss": "blackbear", "aud": "api"}, nil)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenUnverifiable)
+
+	_, err = m.Verify("abc.def")
+	assert.ErrorIs(t, err, ErrTokenMalformed)
+}
+
+func TestJWTVerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := NewJWT(JWTOptions{PublicKey: &key.PublicKey, Algorithms: []string{"RS256"}})
+
+	token := signToken(t, map[string]interface{}{"alg": "RS256"}, map[string]interface{}{"sub": "1"}, key)
+	claims, err := m.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "1", claims.Subject())
+
+	// the token can't be verified by HMAC
+	token = signToken(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "1"}, key.PublicKey.N.Bytes())
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenUnverifiable)
+}
+
+func TestJWTVerifyJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+		},
+	}
+
+	b, err := json.Marshal(jwks)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0600))
+
+	set, err := LoadJWKS(path)
+	require.NoError(t, err)
+
+	m := NewJWT(JWTOptions{JWKS: set})
+
+	token := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa1"}, map[string]interface{}{"sub": "rsa"}, rsaKey)
+	claims, err := m.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "rsa", claims.Subject())
+
+	token = signToken(t, map[string]interface{}{"alg": "ES256", "kid": "ec1"}, map[string]interface{}{"sub": "ec"}, ecKey)
+	claims, err = m.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "ec", claims.Subject())
+
+	token = signToken(t, map[string]interface{}{"alg": "ES256", "kid": "unknown"}, map[string]interface{}{"sub": "ec"}, ecKey)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenUnverifiable)
+
+	// the curve of the key doesn't match the algorithm
+	token = signToken(t, map[string]interface{}{"alg": "ES384", "kid": "ec1"}, map[string]interface{}{"sub": "ec"}, ecKey)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenUnverifiable)
+
+	// invalid point
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"` + encode(make([]byte, 32)) + `","y":"` + encode(make([]byte, 32)) + `"}]}`))
+	assert.Error(t, err)
+}
+
+func TestJWTVerifyES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	m := NewJWT(JWTOptions{PublicKey: &key.PublicKey, Algorithms: []string{"ES256", "ES384", "ES512"}})
+
+	token := signToken(t, map[string]interface{}{"alg": "ES256"}, map[string]interface{}{"sub": "1"}, key)
+	claims, err := m.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "1", claims.Subject())
+
+	// ES512 requires P-521 key
+	token = signToken(t, map[string]interface{}{"alg": "ES512"}, map[string]interface{}{"sub": "1"}, key)
+	_, err = m.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenUnverifiable)
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	secret := []byte("secret")
+
+	s := web.NewServer()
+	s.Use(NewJWT(JWTOptions{Secret: secret}))
+	s.Get("/", func(c *web.Context) error {
+		claims, _ := GetJWTClaims(c)
+		return c.String(200, claims.Subject())
+	})
+
+	token := signToken(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "john"}, secret)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "john", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, `{"code":"invalid_token","message":"Unauthorized"}`, w.Body.String())
+}
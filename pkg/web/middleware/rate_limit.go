@@ -0,0 +1,330 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	cache "github.com/nite-coder/blackbear/pkg/cache/v2"
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+// RateLimitAlgorithm is the algorithm which is used to limit the requests
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows burst up to the limit and refills the tokens at a constant rate (limit / period)
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow limits the requests in a sliding window of the period.  The count of the previous window is
+	// weighted by the overlap, so the memory usage is constant for each key.
+	SlidingWindow
+)
+
+// RateLimitRule describes how many requests are allowed in the period
+type RateLimitRule struct {
+	Limit     int
+	Period    time.Duration
+	Algorithm RateLimitAlgorithm
+}
+
+// RateLimitResult is the result of a rate limit check
+type RateLimitResult struct {
+	// Allowed is true if the request is allowed
+	Allowed bool
+	// Limit is the maximum number of requests in the period
+	Limit int
+	// Remaining is the number of requests which can still be made
+	Remaining int
+	// ResetAfter is the duration until the limit is fully reset
+	ResetAfter time.Duration
+	// RetryAfter is the duration until the next request is allowed.  It is zero if the request is allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore saves the state of the rate limiter.  Implement the interface to share the state between
+// instances, ex: redis.
+type RateLimitStore interface {
+	// Take consumes one request for the key and returns the result
+	Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error)
+}
+
+// RateLimitOptions is a configuration container to setup the rate limit middleware.
+type RateLimitOptions struct {
+	// Limit is the maximum number of requests in the period
+	Limit int
+	// Period is the duration of the limit.  Default value is 1 minute
+	Period time.Duration
+	// Algorithm is the rate limit algorithm.  Default value is TokenBucket
+	Algorithm RateLimitAlgorithm
+	// KeyFunc returns the key which the requests are counted by.  The request won't be limited if the key
+	// is empty.  Default value is `KeyByClientIP`
+	KeyFunc func(c *web.Context) string
+	// Store saves the state of the rate limiter.  Default value is an in-memory store which is stopped by
+	// `RateLimit.Close`.
+	Store RateLimitStore
+}
+
+// RateLimit is a middleware which limits the number of requests.  `X-RateLimit-Limit`, `X-RateLimit-Remaining`
+// and `X-RateLimit-Reset` headers are set to the response.  HTTPError with 429 status code is handled by
+// `WebServer.ErrorHandler` if the limit was reached.
+type RateLimit struct {
+	rule    RateLimitRule
+	keyFunc func(c *web.Context) string
+	store   RateLimitStore
+	// memoryStore is the default store which is owned by the middleware
+	memoryStore *MemoryRateLimitStore
+}
+
+// NewRateLimit returns RateLimit middleware instance
+func NewRateLimit(options RateLimitOptions) *RateLimit {
+	if options.Limit <= 0 {
+		panic("middleware: rate limit must be greater than 0")
+	}
+
+	m := &RateLimit{
+		rule: RateLimitRule{
+			Limit:     options.Limit,
+			Period:    options.Period,
+			Algorithm: options.Algorithm,
+		},
+		keyFunc: options.KeyFunc,
+		store:   options.Store,
+	}
+
+	if m.rule.Period <= 0 {
+		m.rule.Period = time.Minute
+	}
+
+	if m.keyFunc == nil {
+		m.keyFunc = KeyByClientIP()
+	}
+
+	if m.store == nil {
+		m.memoryStore = NewMemoryRateLimitStore()
+		m.store = m.memoryStore
+	}
+
+	return m
+}
+
+// Close stops the default in-memory store.  The store of the options isn't closed, because it may be shared.  It can
+// be registered to `WebServer.OnShutdown`, ex:
+//
+//	s.OnShutdown(func() { _ = rateLimit.Close() })
+func (m *RateLimit) Close() error {
+	if m.memoryStore != nil {
+		return m.memoryStore.Close()
+	}
+	return nil
+}
+
+// KeyByClientIP counts the requests by client ip
+func KeyByClientIP() func(c *web.Context) string {
+	return func(c *web.Context) string {
+		return c.ClientIP()
+	}
+}
+
+// KeyByHeader counts the requests by the value of request header, ex: X-API-Key
+func KeyByHeader(name string) func(c *web.Context) string {
+	return func(c *web.Context) string {
+		return c.RequestHeader(name)
+	}
+}
+
+// Invoke function is a middleware entry
+func (m *RateLimit) Invoke(c *web.Context, next web.HandlerFunc) {
+	key := m.keyFunc(c)
+	if len(key) == 0 {
+		_ = next(c)
+		return
+	}
+
+	result, err := m.store.Take(c.StdContext(), key, m.rule)
+	if err != nil {
+		// the request is allowed if the store is unavailable
+		log.FromContext(c.StdContext()).Warn().Err(err).Msg("middleware: rate limit store failed")
+		_ = next(c)
+		return
+	}
+
+	c.RespHeader("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.RespHeader("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.RespHeader("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+	if result.Allowed {
+		_ = next(c)
+		return
+	}
+
+	c.RespHeader("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+
+	handleError(c, web.NewHTTPError(http.StatusTooManyRequests).WithCode("rate_limit_exceeded"))
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+type rateLimitState struct {
+	mu sync.Mutex
+
+	// token bucket
+	tokens   float64
+	lastTime time.Time
+
+	// sliding window
+	windowStart time.Time
+	prevCount   int
+	currCount   int
+}
+
+// MemoryRateLimitStore is an in-memory RateLimitStore.  The idle keys are removed by the janitor of cache package
+// which runs until `Close` is called.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	states    *cache.Cache[string, *rateLimitState]
+	now       func() time.Time
+	closeOnce sync.Once
+}
+
+// NewMemoryRateLimitStore returns MemoryRateLimitStore instance
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		states: cache.NewCache[string, *rateLimitState](time.Minute),
+		now:    time.Now,
+	}
+}
+
+// Close stops the janitor of the store.  It is safe to call Close more than once.
+func (s *MemoryRateLimitStore) Close() error {
+	s.closeOnce.Do(s.states.StopCleanup)
+	return nil
+}
+
+// Take consumes one request for the key and returns the result
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	now := s.now()
+
+	// the state will be expired after it is fully reset
+	ttl := rule.Period
+	if rule.Algorithm == SlidingWindow {
+		ttl = 2 * rule.Period
+	}
+
+	s.mu.Lock()
+	state, found := s.states.Get(key)
+	if !found {
+		state = &rateLimitState{
+			tokens:      float64(rule.Limit),
+			lastTime:    now,
+			windowStart: now.Truncate(rule.Period),
+		}
+	}
+	s.states.PutWithTTL(key, state, ttl)
+	s.mu.Unlock()
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if rule.Algorithm == SlidingWindow {
+		return state.takeSlidingWindow(now, rule), nil
+	}
+
+	return state.takeTokenBucket(now, rule), nil
+}
+
+func (state *rateLimitState) takeTokenBucket(now time.Time, rule RateLimitRule) RateLimitResult {
+	limit := float64(rule.Limit)
+	rate := limit / rule.Period.Seconds() // tokens per second
+
+	elapsed := now.Sub(state.lastTime).Seconds()
+	if elapsed > 0 {
+		state.tokens = math.Min(limit, state.tokens+elapsed*rate)
+		state.lastTime = now
+	}
+
+	result := RateLimitResult{
+		Limit: rule.Limit,
+	}
+
+	if state.tokens >= 1 {
+		state.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - state.tokens) / rate)
+	}
+
+	result.Remaining = int(math.Floor(state.tokens))
+	result.ResetAfter = secondsToDuration((limit - state.tokens) / rate)
+
+	return result
+}
+
+func (state *rateLimitState) takeSlidingWindow(now time.Time, rule RateLimitRule) RateLimitResult {
+	windowStart := now.Truncate(rule.Period)
+
+	switch {
+	case windowStart.Equal(state.windowStart):
+	case windowStart.Sub(state.windowStart) == rule.Period:
+		state.prevCount = state.currCount
+		state.currCount = 0
+		state.windowStart = windowStart
+	default:
+		state.prevCount = 0
+		state.currCount = 0
+		state.windowStart = windowStart
+	}
+
+	elapsed := now.Sub(windowStart)
+	weight := 1 - float64(elapsed)/float64(rule.Period)
+	count := float64(state.prevCount)*weight + float64(state.currCount)
+
+	result := RateLimitResult{
+		Limit:      rule.Limit,
+		ResetAfter: 2*rule.Period - elapsed,
+	}
+
+	if count+1 <= float64(rule.Limit) {
+		state.currCount++
+		count++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = state.retryAfter(elapsed, rule)
+	}
+
+	result.Remaining = int(math.Max(0, math.Floor(float64(rule.Limit)-count)))
+
+	return result
+}
+
+// retryAfter returns the duration until the weighted count is low enough to allow one more request
+func (state *rateLimitState) retryAfter(elapsed time.Duration, rule RateLimitRule) time.Duration {
+	limit := float64(rule.Limit)
+	untilNextWindow := rule.Period - elapsed
+
+	if float64(state.currCount) >= limit {
+		// the requests of current window will be weighted as the previous window
+		needed := 1 - (limit-1)/float64(state.currCount)
+		return untilNextWindow + time.Duration(needed*float64(rule.Period))
+	}
+
+	// prev * (1 - (elapsed + t) / period) + curr + 1 <= limit
+	t := (1-(limit-1-float64(state.currCount))/float64(state.prevCount))*float64(rule.Period) - float64(elapsed)
+	if t < 0 {
+		return 0
+	}
+
+	return time.Duration(t)
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	rule := RateLimitRule{Limit: 2, Period: 10 * time.Second, Algorithm: TokenBucket}
+
+	result, _ := store.Take(context.Background(), "a", rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	result, _ = store.Take(context.Background(), "a", rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, _ = store.Take(context.Background(), "a", rule)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 5*time.Second, result.RetryAfter)
+	assert.Equal(t, 10*time.Second, result.ResetAfter)
+
+	// other keys are not affected
+	result, _ = store.Take(context.Background(), "b", rule)
+	assert.True(t, result.Allowed)
+
+	// one token is refilled
+	now = now.Add(5 * time.Second)
+	result, _ = store.Take(context.Background(), "a", rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// the janitor is stopped once
+	assert.NoError(t, store.Close())
+	assert.NoError(t, store.Close())
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	rule := RateLimitRule{Limit: 4, Period: 10 * time.Second, Algorithm: SlidingWindow}
+
+	for i := 0; i < 4; i++ {
+		result, _ := store.Take(context.Background(), "a", rule)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3-i, result.Remaining)
+	}
+
+	result, _ := store.Take(context.Background(), "a", rule)
+	assert.False(t, result.Allowed)
+	// 4 * (1 - 2.5 / 10) + 1 <= 4
+	assert.Equal(t, 12500*time.Millisecond, result.RetryAfter)
+
+	// the previous window is weighted by 50%, so 2 requests are allowed
+	now = now.Add(15 * time.Second)
+	result, _ = store.Take(context.Background(), "a", rule)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take(context.Background(), "a", rule)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take(context.Background(), "a", rule)
+	assert.False(t, result.Allowed)
+	// 4 * (1 - (5 + t) / 10) + 2 + 1 <= 4
+	assert.Equal(t, 2500*time.Millisecond, result.RetryAfter)
+
+	// all windows are expired
+	now = now.Add(time.Minute)
+	result, _ = store.Take(context.Background(), "a", rule)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 3, result.Remaining)
+}
+
+type failedStore struct{}
+
+func (failedStore) Take(context.Context, string, RateLimitRule) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("connection refused")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewRateLimit(RateLimitOptions{
+		Limit:   1,
+		Period:  time.Minute,
+		KeyFunc: KeyByHeader("X-API-Key"),
+	}))
+
+	s.Get("/", func(c *web.Context) error {
+		return c.String(200, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "key1")
+	s.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("X-RateLimit-Reset"))
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	assert.Equal(t, 429, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, `{"code":"rate_limit_exceeded","message":"Too Many Requests"}`, w.Body.String())
+
+	// request without key is not limited
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestRateLimitStoreFailed(t *testing.T) {
+	s := web.NewServer()
+	s.Get("/", func(c *web.Context) error {
+		return c.String(200, "ok")
+	}, NewRateLimit(RateLimitOptions{Limit: 1, Store: failedStore{}}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+// ErrPanic is wrapped by the error which is converted from the panic, so user can check it by `errors.Is`
+var ErrPanic = errors.New("panic")
+
+// RecoveryOptions is a configuration container to setup the recovery middleware.
+type RecoveryOptions struct {
+	// Logger is used to log the panic with stack trace.  The default logger of log package is used if it is nil.
+	Logger *log.Logger
+	// DisableStackTrace disables the stack trace in the log
+	DisableStackTrace bool
+	// OnPanic is an optional callback which is invoked after the panic was recovered, ex: report the error to
+	// error tracking service.
+	OnPanic func(c *web.Context, err error, stack []byte)
+}
+
+// Recovery is a middleware which recovers from panics in the handlers.  The panic is converted to an error and
+// handled by `WebServer.ErrorHandler`.  It should be the first middleware, so it can catch all panics.
+type Recovery struct {
+	logger            *log.Logger
+	disableStackTrace bool
+	onPanic           func(c *web.Context, err error, stack []byte)
+}
+
+// NewRecovery returns Recovery middleware instance
+func NewRecovery(options RecoveryOptions) *Recovery {
+	return &Recovery{
+		logger:            options.Logger,
+		disableStackTrace: options.DisableStackTrace,
+		onPanic:           options.OnPanic,
+	}
+}
+
+// Invoke function is a middleware entry
+func (r *Recovery) Invoke(c *web.Context, next web.HandlerFunc) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+
+		// http.ErrAbortHandler is used to abort the handler, so we don't need to handle it.
+		if rec == http.ErrAbortHandler { //nolint:errorlint
+			panic(rec)
+		}
+
+		var err error
+		switch v := rec.(type) {
+		case error:
+			err = fmt.Errorf("%w: %w", ErrPanic, v)
+		default:
+			err = fmt.Errorf("%w: %v", ErrPanic, v)
+		}
+
+		logger := r.logger
+		if logger == nil {
+			logger = log.Default()
+		}
+
+		entry := logger.Error().
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Err(err)
+
+		if !r.disableStackTrace {
+			entry = entry.StackTrace()
+		}
+
+		entry.Msg("web: panic recovered")
+
+		if r.onPanic != nil {
+			r.onPanic(c, err, debug.Stack())
+		}
+
+		handleError(c, web.NewHTTPError(http.StatusInternalServerError).Wrap(err))
+	}()
+
+	_ = next(c)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecovery(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := log.New(log.NewJSONHandler(buf, &log.HandlerOptions{Level: log.DebugLevel}))
+
+	var reported error
+
+	s := web.NewServer()
+	s.Use(NewRecovery(RecoveryOptions{
+		Logger: logger,
+		OnPanic: func(c *web.Context, err error, stack []byte) {
+			reported = err
+			assert.NotEmpty(t, stack)
+		},
+	}))
+
+	s.Get("/panic", func(c *web.Context) error {
+		var m map[string]string
+		m["boom"] = "oops"
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/panic", nil)
+		s.ServeHTTP(w, req)
+
+		assert.Equal(t, 500, w.Code)
+		assert.Equal(t, `{"message":"Internal Server Error"}`, w.Body.String())
+	}
+
+	assert.True(t, errors.Is(reported, ErrPanic))
+	assert.Contains(t, buf.String(), "web: panic recovered")
+	assert.Contains(t, buf.String(), "stack_trace")
+	assert.Contains(t, buf.String(), "recovery_test.go")
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewRecovery(RecoveryOptions{Logger: log.New(log.NewJSONHandler(&bytes.Buffer{}, &log.HandlerOptions{}))}))
+
+	s.Get("/abort", func(c *web.Context) error {
+		panic(http.ErrAbortHandler)
+	})
+
+	req, _ := http.NewRequest("GET", "/abort", nil)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+const (
+	// RequestIDKey is the key which is used to save the request id in `web.Context`
+	RequestIDKey = "request_id"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID is a middleware which propagates the `X-Request-Id` header.  The request id is generated if the
+// request doesn't have a valid one.  The id is set to the response header, saved in `web.Context` and a child
+// logger with `request_id` field is attached to the standard context, so `log.FromContext(c.StdContext())`
+// carries the request id.
+type RequestID struct {
+}
+
+// NewRequestID returns RequestID middleware instance
+func NewRequestID() *RequestID {
+	return &RequestID{}
+}
+
+// Invoke function is a middleware entry
+func (m *RequestID) Invoke(c *web.Context, next web.HandlerFunc) {
+	id := c.RequestHeader(headerRequestID)
+	if !isValidRequestID(id) {
+		id = newRequestID()
+	}
+
+	c.RespHeader(headerRequestID, id)
+	c.Set(RequestIDKey, id)
+
+	logger := log.FromContext(c.Request.Context()).With().Str(RequestIDKey, id).Logger()
+	c.SetStdContext(logger.WithContext(c.Request.Context()))
+
+	_ = next(c)
+}
+
+// GetRequestID returns the request id which is saved by RequestID middleware
+func GetRequestID(c *web.Context) string {
+	val, found := c.Get(RequestIDKey)
+	if !found {
+		return ""
+	}
+
+	id, _ := val.(string)
+	return id
+}
+
+// newRequestID returns a random UUID (version 4)
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+
+	return string(buf)
+}
+
+// isValidRequestID prevents the client to inject unexpected characters into our logs
+func isValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		b := id[i]
+		if b < 0x21 || b > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defaultLogger := log.Default()
+	log.SetDefault(log.New(log.NewJSONHandler(buf, &log.HandlerOptions{Level: log.DebugLevel})))
+	defer log.SetDefault(defaultLogger)
+
+	var id string
+
+	s := web.NewServer()
+	s.Use(NewRequestID())
+	s.Get("/", func(c *web.Context) error {
+		id = GetRequestID(c)
+		log.FromContext(c.StdContext()).Info().Msg("hello")
+		return nil
+	})
+
+	// generate a new request id
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+
+	assert.Len(t, id, 36)
+	assert.Equal(t, id, w.Header().Get("X-Request-Id"))
+	assert.Contains(t, buf.String(), `"request_id":"`+id+`"`)
+
+	// use the request id from the client
+	buf.Reset()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "my-request-id")
+	s.ServeHTTP(w, req)
+
+	assert.Equal(t, "my-request-id", id)
+	assert.Equal(t, "my-request-id", w.Header().Get("X-Request-Id"))
+	assert.Equal(t, 1, strings.Count(buf.String(), `"request_id":"my-request-id"`))
+
+	// invalid request id will be replaced
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "bad id\n")
+	s.ServeHTTP(w, req)
+
+	assert.Len(t, id, 36)
+}
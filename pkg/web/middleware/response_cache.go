@@ -0,0 +1,650 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/nite-coder/blackbear/pkg/cache/v2"
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+const (
+	headerCacheControl    = "Cache-Control"
+	headerETag            = "ETag"
+	headerLastModified    = "Last-Modified"
+	headerIfNoneMatch     = "If-None-Match"
+	headerIfModifiedSince = "If-Modified-Since"
+	headerXCache          = "X-Cache"
+
+	defaultResponseCacheTTL         = time.Minute
+	defaultResponseCacheMaxBodySize = 1 << 20 // 1MB
+)
+
+// CachedResponse is a response which is saved in ResponseCacheStore
+type CachedResponse struct {
+	Status       int
+	Header       http.Header
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+	StoredAt     time.Time
+	// Expires is the time until the response is fresh
+	Expires time.Time
+	// StaleUntil is the time until the stale response can be served while it is revalidated in background
+	StaleUntil time.Time
+}
+
+// ResponseCacheStore saves the cached responses.  Implement the interface to share the cache between instances,
+// ex: redis.
+type ResponseCacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, bool, error)
+	Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// ResponseCacheOptions is a configuration container to setup the response cache middleware.
+type ResponseCacheOptions struct {
+	// TTL is used when the response doesn't have `max-age` or `s-maxage` directive.  Default value is 1 minute.
+	TTL time.Duration
+	// StaleWhileRevalidate is used when the response doesn't have `stale-while-revalidate` directive.
+	StaleWhileRevalidate time.Duration
+	// VaryHeaders are the request headers which are included in the cache key.  The response which varies by
+	// other headers isn't cached.
+	VaryHeaders []string
+	// MaxBodySize is the maximum size of the response body to be cached.  Default value is 1MB.
+	MaxBodySize int
+}
+
+type inflightResponse struct {
+	done chan struct{}
+	resp *CachedResponse
+}
+
+// ResponseCache is a middleware which caches the responses of GET and HEAD requests.  The `ETag` header is generated
+// if the handler doesn't set it and conditional requests are answered with 304 status code.  Concurrent misses of
+// the same key are coalesced, so the handler is only executed once.
+type ResponseCache struct {
+	store                ResponseCacheStore
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	varyHeaders          []string
+	maxBodySize          int
+	now                  func() time.Time
+
+	mu           sync.Mutex
+	inflight     map[string]*inflightResponse
+	revalidating map[string]bool
+	// memoryStore is the default store which is owned by the middleware
+	memoryStore *MemoryResponseCacheStore
+}
+
+// NewResponseCache returns ResponseCache middleware instance.  An in-memory store is used if the store is nil and
+// it is stopped by `Close`.
+func NewResponseCache(store ResponseCacheStore, options ResponseCacheOptions) *ResponseCache {
+	m := &ResponseCache{
+		store:                store,
+		ttl:                  options.TTL,
+		staleWhileRevalidate: options.StaleWhileRevalidate,
+		maxBodySize:          options.MaxBodySize,
+		now:                  time.Now,
+		inflight:             map[string]*inflightResponse{},
+		revalidating:         map[string]bool{},
+	}
+
+	for _, name := range options.VaryHeaders {
+		m.varyHeaders = append(m.varyHeaders, http.CanonicalHeaderKey(name))
+	}
+
+	if m.store == nil {
+		m.memoryStore = NewMemoryResponseCacheStore()
+		m.store = m.memoryStore
+	}
+
+	if m.ttl <= 0 {
+		m.ttl = defaultResponseCacheTTL
+	}
+
+	if m.maxBodySize <= 0 {
+		m.maxBodySize = defaultResponseCacheMaxBodySize
+	}
+
+	return m
+}
+
+// Close stops the default in-memory store.  The store of the argument isn't closed, because it may be shared.  It
+// can be registered to `WebServer.OnShutdown`, ex:
+//
+//	s.OnShutdown(func() { _ = responseCache.Close() })
+func (m *ResponseCache) Close() error {
+	if m.memoryStore != nil {
+		return m.memoryStore.Close()
+	}
+	return nil
+}
+
+// Invoke function is a middleware entry
+func (m *ResponseCache) Invoke(c *web.Context, next web.HandlerFunc) {
+	req := c.Request
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		_ = next(c)
+		return
+	}
+
+	directives := parseCacheControl(req.Header.Get(headerCacheControl))
+	if _, found := directives["no-store"]; found || len(req.Header.Get("Authorization")) > 0 {
+		_ = next(c)
+		return
+	}
+
+	key := m.key(c)
+	ctx := c.StdContext()
+
+	_, noCache := directives["no-cache"]
+
+	if !noCache {
+		resp, found, err := m.store.Get(ctx, key)
+		if err != nil {
+			log.FromContext(ctx).Warn().Err(err).Msg("middleware: response cache store failed")
+		}
+
+		if found && resp != nil {
+			now := m.now()
+
+			if now.Before(resp.Expires) {
+				m.serve(c, resp, "HIT")
+				return
+			}
+
+			if now.Before(resp.StaleUntil) {
+				m.revalidate(c, next, key)
+				m.serve(c, resp, "STALE")
+				return
+			}
+		}
+	}
+
+	// the HEAD request is served from the cache of GET request, but it doesn't fill the cache
+	if req.Method == http.MethodHead {
+		_ = next(c)
+		return
+	}
+
+	m.mu.Lock()
+	call, found := m.inflight[key]
+	if found {
+		m.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-req.Context().Done():
+			return
+		}
+
+		if call.resp != nil {
+			m.serve(c, call.resp, "HIT")
+			return
+		}
+
+		// the response of the leader can't be cached
+		_ = next(c)
+		return
+	}
+
+	call = &inflightResponse{done: make(chan struct{})}
+	m.inflight[key] = call
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.inflight, key)
+		m.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.resp = m.execute(c, next, key)
+}
+
+// key returns the cache key which contains the host, the path, the sorted query string and the vary headers.
+// HEAD requests share the key of GET requests.
+func (m *ResponseCache) key(c *web.Context) string {
+	var sb strings.Builder
+
+	sb.WriteString("GET ")
+	sb.WriteString(c.Host())
+	sb.WriteString(c.Request.URL.Path)
+
+	if query := c.Request.URL.Query(); len(query) > 0 {
+		sb.WriteString("?")
+		sb.WriteString(query.Encode())
+	}
+
+	for _, name := range m.varyHeaders {
+		sb.WriteString("\n")
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(c.Request.Header.Values(name), ","))
+	}
+
+	return sb.String()
+}
+
+// execute runs the handler and saves the response if it is cacheable.  The response is written to the client
+// after the ETag is generated, so the conditional request can be answered with 304 as well.
+func (m *ResponseCache) execute(c *web.Context, next web.HandlerFunc, key string) *CachedResponse {
+	// the headers which were set by the previous middleware, ex: request id, are not cached
+	before := c.Writer.Header().Clone()
+
+	w := c.Writer
+	cw := &cacheWriter{
+		ResponseWriter: w,
+		maxBodySize:    m.maxBodySize,
+		status:         http.StatusOK,
+	}
+
+	c.Writer = cw
+
+	completed := false
+	defer func() {
+		if !completed {
+			c.Writer = w
+		}
+	}()
+
+	err := next(c)
+	completed = true
+	c.Writer = w
+
+	if cw.passthrough {
+		return nil
+	}
+
+	// the error is rendered by the ErrorHandler after the middleware returns
+	if err != nil {
+		if cw.headerWritten {
+			_ = cw.flush()
+		}
+		return nil
+	}
+
+	resp := m.newCachedResponse(cw, before)
+	if resp == nil {
+		_ = cw.flush()
+		return nil
+	}
+
+	ttl := resp.StaleUntil.Sub(resp.StoredAt)
+	if err := m.store.Set(c.StdContext(), key, resp, ttl); err != nil {
+		log.FromContext(c.StdContext()).Warn().Err(err).Msg("middleware: response cache store failed")
+	}
+
+	m.serve(c, resp, "MISS")
+
+	return resp
+}
+
+// newCachedResponse returns nil if the response can't be cached
+func (m *ResponseCache) newCachedResponse(cw *cacheWriter, before http.Header) *CachedResponse {
+	header := cw.Header()
+
+	if cw.status != http.StatusOK || len(header.Get("Set-Cookie")) > 0 {
+		return nil
+	}
+
+	directives := parseCacheControl(header.Get(headerCacheControl))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, found := directives[directive]; found {
+			return nil
+		}
+	}
+
+	// the response varies by the headers which are not in the cache key
+	beforeVary := varyNames(before.Values(headerVary))
+	for name := range varyNames(header.Values(headerVary)) {
+		if beforeVary[name] {
+			continue
+		}
+
+		if name == "*" || !m.isVaryHeader(name) {
+			return nil
+		}
+	}
+
+	now := m.now()
+
+	ttl := m.ttl
+	if v, found := directives["s-maxage"]; found {
+		ttl = parseSeconds(v, ttl)
+	} else if v, found := directives["max-age"]; found {
+		ttl = parseSeconds(v, ttl)
+	}
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	staleWhileRevalidate := m.staleWhileRevalidate
+	if v, found := directives["stale-while-revalidate"]; found {
+		staleWhileRevalidate = parseSeconds(v, staleWhileRevalidate)
+	}
+
+	resp := &CachedResponse{
+		Status:   cw.status,
+		Header:   http.Header{},
+		Body:     cw.buf,
+		ETag:     header.Get(headerETag),
+		StoredAt: now,
+		Expires:  now.Add(ttl),
+	}
+	resp.StaleUntil = resp.Expires.Add(staleWhileRevalidate)
+
+	for name, values := range header {
+		if equalValues(before.Values(name), values) {
+			continue
+		}
+		resp.Header[name] = append([]string(nil), values...)
+	}
+
+	if len(resp.ETag) == 0 {
+		sum := sha256.Sum256(cw.buf)
+		resp.ETag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+
+	resp.LastModified = now
+	if t, err := http.ParseTime(header.Get(headerLastModified)); err == nil {
+		resp.LastModified = t
+	}
+
+	return resp
+}
+
+func (m *ResponseCache) isVaryHeader(name string) bool {
+	for _, v := range m.varyHeaders {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// serve writes the cached response.  304 status code is returned if the client has the same version.
+func (m *ResponseCache) serve(c *web.Context, resp *CachedResponse, status string) {
+	header := c.Writer.Header()
+
+	for name, values := range resp.Header {
+		header[name] = append([]string(nil), values...)
+	}
+
+	header.Set(headerETag, resp.ETag)
+	header.Set(headerXCache, status)
+
+	if status != "MISS" {
+		age := m.now().Sub(resp.StoredAt)
+		header.Set("Age", strconv.Itoa(int(age.Seconds())))
+	}
+
+	if isNotModified(c.Request, resp) {
+		header.Del(headerContentLength)
+		header.Del(headerContentType)
+		c.Writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set(headerContentLength, strconv.Itoa(len(resp.Body)))
+	c.Writer.WriteHeader(resp.Status)
+
+	if c.Request.Method != http.MethodHead {
+		_, _ = c.Writer.Write(resp.Body)
+	}
+}
+
+// revalidate refreshes the cache in background.  Only the downstream handlers are executed, so the previous
+// middleware, ex: logging or rate limit, don't see a phantom request.  The context is copied because it is reused
+// after the handler returns.
+func (m *ResponseCache) revalidate(c *web.Context, next web.HandlerFunc, key string) {
+	m.mu.Lock()
+	if m.revalidating[key] {
+		m.mu.Unlock()
+		return
+	}
+	m.revalidating[key] = true
+	m.mu.Unlock()
+
+	cp := c.Copy(&discardResponseWriter{header: http.Header{}})
+	cp.Request.Method = http.MethodGet
+	cp.Request.Header.Del(headerIfNoneMatch)
+	cp.Request.Header.Del(headerIfModifiedSince)
+
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			delete(m.revalidating, key)
+			m.mu.Unlock()
+
+			// the recovery middleware doesn't cover the goroutine, so the panic would crash the process
+			if rec := recover(); rec != nil {
+				log.FromContext(cp.StdContext()).Error().
+					Str("path", cp.Request.URL.Path).
+					Err(fmt.Errorf("%w: %v", ErrPanic, rec)).
+					StackTrace().
+					Msg("middleware: response cache revalidation panicked")
+			}
+		}()
+
+		m.execute(cp, next, key)
+	}()
+}
+
+func isNotModified(req *http.Request, resp *CachedResponse) bool {
+	if inm := req.Header.Get(headerIfNoneMatch); len(inm) > 0 {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(resp.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := req.Header.Get(headerIfModifiedSince); len(ims) > 0 {
+		t, err := http.ParseTime(ims)
+		if err == nil && !resp.LastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := map[string]string{}
+
+	for _, part := range strings.Split(value, ",") {
+		name, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) > 0 {
+			directives[name] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+
+	return directives
+}
+
+func parseSeconds(value string, defaultValue time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func varyNames(values []string) map[string]bool {
+	names := map[string]bool{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) > 0 {
+				names[http.CanonicalHeaderKey(name)] = true
+			}
+		}
+	}
+	return names
+}
+
+func equalValues(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheWriter buffers the response body.  The response is passed through if it is too large or flushed.
+type cacheWriter struct {
+	web.ResponseWriter
+	maxBodySize   int
+	status        int
+	headerWritten bool
+	passthrough   bool
+	buf           []byte
+}
+
+// WriteHeader saves the status code
+func (cw *cacheWriter) WriteHeader(statusCode int) {
+	if cw.headerWritten || cw.ResponseWriter.Written() {
+		return
+	}
+
+	cw.status = statusCode
+	cw.headerWritten = true
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.headerWritten {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+
+	if len(cw.buf) > cw.maxBodySize {
+		cw.passthrough = true
+
+		if err := cw.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// flush writes the status code and the buffered body to the original writer
+func (cw *cacheWriter) flush() error {
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) > 0 {
+		buf := cw.buf
+		cw.buf = nil
+
+		if _, err := cw.ResponseWriter.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status returns http status code
+func (cw *cacheWriter) Status() int {
+	if cw.ResponseWriter.Written() {
+		return cw.ResponseWriter.Status()
+	}
+	return cw.status
+}
+
+// Written returns true if the response header has been written
+func (cw *cacheWriter) Written() bool {
+	return cw.headerWritten || cw.ResponseWriter.Written()
+}
+
+// Flush stops buffering, because the streaming response is not cached
+func (cw *cacheWriter) Flush() {
+	if !cw.passthrough {
+		cw.passthrough = true
+		_ = cw.flush()
+	}
+	cw.ResponseWriter.Flush()
+}
+
+// Unwrap returns the wrapped writer, so http.NewResponseController is able to find the optional interfaces
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// discardResponseWriter is used by the background revalidation
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
+
+// MemoryResponseCacheStore is an in-memory ResponseCacheStore.  The expired responses are removed by the janitor of
+// cache package which runs until `Close` is called.
+type MemoryResponseCacheStore struct {
+	responses *cache.Cache[string, *CachedResponse]
+	closeOnce sync.Once
+}
+
+// NewMemoryResponseCacheStore returns MemoryResponseCacheStore instance
+func NewMemoryResponseCacheStore() *MemoryResponseCacheStore {
+	return &MemoryResponseCacheStore{
+		responses: cache.NewCache[string, *CachedResponse](time.Minute),
+	}
+}
+
+// Get returns the cached response of the key
+func (s *MemoryResponseCacheStore) Get(_ context.Context, key string) (*CachedResponse, bool, error) {
+	resp, found := s.responses.Get(key)
+	return resp, found, nil
+}
+
+// Set saves the response with the ttl
+func (s *MemoryResponseCacheStore) Set(_ context.Context, key string, resp *CachedResponse, ttl time.Duration) error {
+	s.responses.PutWithTTL(key, resp, ttl)
+	return nil
+}
+
+// Delete removes the cached response of the key
+func (s *MemoryResponseCacheStore) Delete(_ context.Context, key string) error {
+	s.responses.Delete(key)
+	return nil
+}
+
+// Close stops the janitor of the store.  It is safe to call Close more than once.
+func (s *MemoryResponseCacheStore) Close() error {
+	s.closeOnce.Do(s.responses.StopCleanup)
+	return nil
+}
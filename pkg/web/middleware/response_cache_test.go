@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCache(t *testing.T) {
+	var count atomic.Int32
+
+	s := web.NewServer()
+	s.Use(NewResponseCache(nil, ResponseCacheOptions{VaryHeaders: []string{"Accept-Language"}}))
+	s.Get("/users", func(c *web.Context) error {
+		n := count.Add(1)
+		c.RespHeader("Vary", "Accept-Language")
+		return c.String(200, "users "+strconv.Itoa(int(n)))
+	})
+	s.Get("/private", func(c *web.Context) error {
+		n := count.Add(1)
+		c.RespHeader("Cache-Control", "private")
+		return c.String(200, strconv.Itoa(int(n)))
+	})
+
+	request := func(path string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/users?b=2&a=1")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "users 1", w.Body.String())
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// the query string is sorted
+	w = request("/users?a=1&b=2")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "users 1", w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, "0", w.Header().Get("Age"))
+
+	// the vary header is a part of the key
+	w = request("/users?a=1&b=2", "Accept-Language", "fr")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "users 2", w.Body.String())
+
+	// the host is a part of the key
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://other.example/users?a=1&b=2", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "users 3", w.Body.String())
+
+	w = request("/users?a=1&b=2", "If-None-Match", etag)
+	assert.Equal(t, 304, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = request("/users?a=1&b=2", "If-Modified-Since", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.Equal(t, 304, w.Code)
+
+	w = request("/users?a=1&b=2", "Cache-Control", "no-cache")
+	assert.Equal(t, "users 4", w.Body.String())
+
+	w = request("/private")
+	assert.Equal(t, "5", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Cache"))
+	w = request("/private")
+	assert.Equal(t, "6", w.Body.String())
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	var count, requests atomic.Int32
+	refreshed := make(chan struct{}, 1)
+
+	m := NewResponseCache(nil, ResponseCacheOptions{})
+	defer func() { assert.NoError(t, m.Close()) }()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	s := web.NewServer()
+	s.UseFunc(func(c *web.Context, next web.HandlerFunc) {
+		requests.Add(1)
+		_ = next(c)
+	})
+	s.Use(m)
+	s.Get("/", func(c *web.Context) error {
+		n := count.Add(1)
+		if n > 1 {
+			defer func() { refreshed <- struct{}{} }()
+		}
+		c.RespHeader("Cache-Control", "max-age=10, stale-while-revalidate=30")
+		return c.String(200, strconv.Itoa(int(n)))
+	})
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request()
+	assert.Equal(t, "1", w.Body.String())
+
+	now = now.Add(20 * time.Second)
+	w = request()
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, "20", w.Header().Get("Age"))
+	assert.Equal(t, "1", w.Body.String())
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("the response wasn't revalidated")
+	}
+
+	// the previous middleware doesn't see the revalidation
+	assert.Equal(t, int32(2), requests.Load())
+
+	assert.Eventually(t, func() bool {
+		w := request()
+		return w.Header().Get("X-Cache") == "HIT" && w.Body.String() == "2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestResponseCacheRevalidateDetached(t *testing.T) {
+	var count atomic.Int32
+	canceled := make(chan struct{})
+	revalidated := make(chan error, 1)
+
+	m := NewResponseCache(nil, ResponseCacheOptions{})
+	defer func() { assert.NoError(t, m.Close()) }()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	s := web.NewServer()
+	s.Use(NewTimeout(TimeoutOptions{Timeout: time.Second}))
+	s.Get("/", func(c *web.Context) error {
+		n := count.Add(1)
+		if n > 1 {
+			// the client of the stale response has left
+			<-canceled
+			time.Sleep(10 * time.Millisecond)
+			// the route timeout sets its own deadline instead of the state of the original request
+			if _, found := c.StdContext().Deadline(); !found {
+				revalidated <- errors.New("the deadline wasn't set")
+			} else {
+				revalidated <- c.StdContext().Err()
+			}
+			panic("revalidation failed")
+		}
+		c.RespHeader("Cache-Control", "max-age=10, stale-while-revalidate=30")
+		return c.String(200, strconv.Itoa(int(n)))
+	}, m, NewTimeout(TimeoutOptions{Timeout: time.Second}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, "1", w.Body.String())
+
+	now = now.Add(20 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(ctx, "GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	cancel()
+	close(canceled)
+
+	// the revalidation isn't canceled by the original request and the panic is recovered
+	select {
+	case err := <-revalidated:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the response wasn't revalidated")
+	}
+
+	assert.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.revalidating) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestResponseCacheCoalescing(t *testing.T) {
+	var count atomic.Int32
+	release := make(chan struct{})
+
+	s := web.NewServer()
+	s.Use(NewResponseCache(nil, ResponseCacheOptions{}))
+	s.Get("/", func(c *web.Context) error {
+		count.Add(1)
+		<-release
+		return c.String(200, "hello")
+	})
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 5)
+
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/", nil)
+			s.ServeHTTP(w, req)
+		}(recorders[i])
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), count.Load())
+	for _, w := range recorders {
+		require.Equal(t, 200, w.Code)
+		assert.Equal(t, "hello", w.Body.String())
+	}
+}
+
+func TestResponseCacheNotCacheable(t *testing.T) {
+	var count atomic.Int32
+
+	s := web.NewServer()
+	s.Use(NewResponseCache(nil, ResponseCacheOptions{MaxBodySize: 4}))
+	s.Get("/cookie", func(c *web.Context) error {
+		count.Add(1)
+		c.SetCookie("session", "1", 0, "", "", false, true)
+		return c.String(200, "ok")
+	})
+	s.Get("/large", func(c *web.Context) error {
+		count.Add(1)
+		return c.String(200, "hello world")
+	})
+	s.Get("/error", func(c *web.Context) error {
+		count.Add(1)
+		return web.NewHTTPError(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/cookie", "/large", "/error"} {
+		count.Store(0)
+
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			s.ServeHTTP(w, req)
+			assert.Empty(t, w.Header().Get("X-Cache"), path)
+		}
+
+		assert.Equal(t, int32(2), count.Load(), path)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/large", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, "hello world", w.Body.String())
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+// NoncePlaceholder is replaced with the nonce of the request in the Content-Security-Policy, ex:
+// "script-src 'self' 'nonce-{nonce}'"
+const NoncePlaceholder = "{nonce}"
+
+const defaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// SecureOptions is a configuration container to setup the secure middleware.  The empty value of the string
+// options uses the default value and "-" disables the header.
+type SecureOptions struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security header which is only sent if `Context.Scheme` is
+	// https.  Default value is one year and negative value disables the header.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// ContentSecurityPolicy is not sent by default.  `NoncePlaceholder` is replaced with a random nonce for each
+	// request and the nonce is available to the templates by `cspNonce` function.
+	ContentSecurityPolicy string
+	// CSPReportOnly sends Content-Security-Policy-Report-Only header instead
+	CSPReportOnly bool
+	// FrameOptions is X-Frame-Options header.  Default value is "DENY"
+	FrameOptions string
+	// ReferrerPolicy is Referrer-Policy header.  Default value is "strict-origin-when-cross-origin"
+	ReferrerPolicy string
+	// PermissionsPolicy is Permissions-Policy header which is not sent by default, ex: "camera=(), microphone=()"
+	PermissionsPolicy string
+	// ContentTypeNosniff is X-Content-Type-Options header.  Default value is "nosniff"
+	ContentTypeNosniff string
+}
+
+// Secure is a middleware which sets the security headers to the response.  The headers are set before the handler
+// is called, so the handler is able to override them.
+type Secure struct {
+	hsts               string
+	csp                string
+	cspHeader          string
+	cspNonce           bool
+	frameOptions       string
+	referrerPolicy     string
+	permissionsPolicy  string
+	contentTypeNosniff string
+}
+
+// NewSecure returns Secure middleware instance
+func NewSecure(options SecureOptions) *Secure {
+	m := &Secure{
+		csp:                options.ContentSecurityPolicy,
+		cspHeader:          "Content-Security-Policy",
+		cspNonce:           strings.Contains(options.ContentSecurityPolicy, NoncePlaceholder),
+		frameOptions:       headerValue(options.FrameOptions, "DENY"),
+		referrerPolicy:     headerValue(options.ReferrerPolicy, "strict-origin-when-cross-origin"),
+		permissionsPolicy:  headerValue(options.PermissionsPolicy, ""),
+		contentTypeNosniff: headerValue(options.ContentTypeNosniff, "nosniff"),
+	}
+
+	if options.CSPReportOnly {
+		m.cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	maxAge := options.HSTSMaxAge
+	if maxAge == 0 {
+		maxAge = defaultHSTSMaxAge
+	}
+
+	if maxAge > 0 {
+		m.hsts = "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+
+		if options.HSTSIncludeSubdomains {
+			m.hsts += "; includeSubDomains"
+		}
+
+		if options.HSTSPreload {
+			m.hsts += "; preload"
+		}
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *Secure) Invoke(c *web.Context, next web.HandlerFunc) {
+	header := c.Writer.Header()
+
+	if len(m.hsts) > 0 && c.Scheme() == "https" {
+		header.Set("Strict-Transport-Security", m.hsts)
+	}
+
+	if len(m.csp) > 0 {
+		csp := m.csp
+
+		if m.cspNonce {
+			nonce := randomToken(16)
+			c.Set(web.CSPNonceKey, nonce)
+			csp = strings.ReplaceAll(csp, NoncePlaceholder, nonce)
+		}
+
+		header.Set(m.cspHeader, csp)
+	}
+
+	setHeader(header, "X-Frame-Options", m.frameOptions)
+	setHeader(header, "Referrer-Policy", m.referrerPolicy)
+	setHeader(header, "Permissions-Policy", m.permissionsPolicy)
+	setHeader(header, "X-Content-Type-Options", m.contentTypeNosniff)
+
+	_ = next(c)
+}
+
+// headerValue returns the default value if the value is empty and "-" disables the header
+func headerValue(value string, defaultValue string) string {
+	switch value {
+	case "":
+		return defaultValue
+	case "-":
+		return ""
+	default:
+		return value
+	}
+}
+
+func setHeader(header http.Header, name string, value string) {
+	if len(value) > 0 {
+		header.Set(name, value)
+	}
+}
+
+// randomToken returns a url-safe base64 string of n random bytes
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
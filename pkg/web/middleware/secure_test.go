@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecure(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewSecure(SecureOptions{
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "script-src 'self' 'nonce-{nonce}'",
+		FrameOptions:          "SAMEORIGIN",
+		PermissionsPolicy:     "camera=()",
+	}))
+	s.Get("/", func(c *web.Context) error {
+		return c.String(200, c.CSPNonce())
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+
+	nonce := w.Body.String()
+	assert.Len(t, nonce, 22)
+	assert.Equal(t, "script-src 'self' 'nonce-"+nonce+"'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "SAMEORIGIN", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "camera=()", w.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	// hsts is only sent over tls
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	s.ServeHTTP(w, req)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.NotEqual(t, nonce, w.Body.String())
+}
+
+func TestSecureDisableHeaders(t *testing.T) {
+	s := web.NewServer()
+	s.Use(NewSecure(SecureOptions{
+		HSTSMaxAge:   -1,
+		FrameOptions: "-",
+	}))
+	s.Get("/", func(c *web.Context) error {
+		return c.String(200, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	s.ServeHTTP(w, req)
+
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, w.Header().Get("X-Frame-Options"))
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+}
+
+func TestSecureRender(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "shares"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "views"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shares", "script.html"),
+		[]byte(`{{define "script"}}<script nonce="{{cspNonce}}"></script>{{end}}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "views", "form.html"),
+		[]byte(`{{template "script"}}<input name="_csrf" value="{{csrfToken}}">`), 0o600))
+
+	s := web.NewServer()
+	s.SetRender(dir)
+	s.Use(NewSecure(SecureOptions{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}))
+	s.Use(NewCSRF(CSRFOptions{}))
+	s.Get("/form", func(c *web.Context) error {
+		return c.Render(200, "form.html", nil)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/form", nil)
+	s.ServeHTTP(w, req)
+
+	require.Equal(t, 200, w.Code)
+	nonce := strings.TrimSuffix(strings.TrimPrefix(w.Header().Get("Content-Security-Policy"), "script-src 'nonce-"), "'")
+	assert.Contains(t, w.Body.String(), `<script nonce="`+nonce+`">`)
+
+	cookie := w.Result().Cookies()[0]
+	assert.Contains(t, w.Body.String(), `value="`+cookie.Value+`"`)
+}
@@ -0,0 +1,460 @@
+package middleware
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/nite-coder/blackbear/pkg/cache/v2"
+	"github.com/nite-coder/blackbear/pkg/log"
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+const (
+	defaultSessionCookieName      = "session"
+	defaultSessionIdleTimeout     = 30 * time.Minute
+	defaultSessionAbsoluteTimeout = 24 * time.Hour
+	minSessionKeyLength           = 32
+	maxSessionCookieSize          = 4096
+)
+
+var (
+	// ErrSessionCookieInvalid is returned when the signature of the cookie is invalid or the cookie can't be decrypted
+	ErrSessionCookieInvalid = errors.New("middleware: session cookie is invalid")
+	// ErrSessionCookieTooLarge is returned when the encoded session is larger than 4096 bytes.  Use SessionStore
+	// to save large sessions.
+	ErrSessionCookieTooLarge = errors.New("middleware: session cookie is too large")
+)
+
+// SessionStore saves the sessions on the server side, so the cookie only contains the session id.  Implement the
+// interface to share the sessions between instances, ex: redis.
+type SessionStore interface {
+	Load(ctx context.Context, id string) ([]byte, bool, error)
+	Save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionOptions is a configuration container to setup the session middleware.
+type SessionOptions struct {
+	// Keys sign the cookie by HMAC-SHA256 and each key must be at least 32 bytes.  The first key is used to sign
+	// new cookies and the others are only used to verify, so the keys can be rotated without signing users out.
+	Keys [][]byte
+	// Encrypt encrypts the cookie by AES-GCM with the keys
+	Encrypt bool
+	// Store saves the sessions on the server side.  The sessions are saved in the cookie if it is nil.
+	Store SessionStore
+	// CookieName is the name of the session cookie.  Default value is "session"
+	CookieName     string
+	CookiePath     string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieHTTPOnly bool
+	// CookieSameSite is the SameSite attribute of the cookie.  Default value is http.SameSiteLaxMode
+	CookieSameSite http.SameSite
+	// IdleTimeout expires the session which is not accessed for the duration.  Default value is 30 minutes and
+	// negative value disables it.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires the session after the duration since it was created.  Default value is 24 hours and
+	// negative value disables it.
+	AbsoluteTimeout time.Duration
+}
+
+// Session is a middleware which loads the session of the request and saves it before the response header is
+// written.  The session is available by `Context.Session`.  The cookie isn't sent until the session is modified.
+type Session struct {
+	keys            [][]byte
+	aeads           []cipher.AEAD
+	store           SessionStore
+	cookieName      string
+	cookiePath      string
+	cookieDomain    string
+	cookieSecure    bool
+	cookieHTTPOnly  bool
+	cookieSameSite  http.SameSite
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	now             func() time.Time
+}
+
+// NewSession returns Session middleware instance
+func NewSession(options SessionOptions) *Session {
+	if len(options.Keys) == 0 {
+		panic("middleware: session keys can't be empty")
+	}
+
+	m := &Session{
+		keys:            options.Keys,
+		store:           options.Store,
+		cookieName:      options.CookieName,
+		cookiePath:      options.CookiePath,
+		cookieDomain:    options.CookieDomain,
+		cookieSecure:    options.CookieSecure,
+		cookieHTTPOnly:  options.CookieHTTPOnly,
+		cookieSameSite:  options.CookieSameSite,
+		idleTimeout:     options.IdleTimeout,
+		absoluteTimeout: options.AbsoluteTimeout,
+		now:             time.Now,
+	}
+
+	for _, key := range options.Keys {
+		if len(key) < minSessionKeyLength {
+			panic("middleware: session key must be at least 32 bytes")
+		}
+
+		if options.Encrypt {
+			// the encryption key is derived from the key, so the same key isn't used by hmac and aes
+			mac := hmac.New(sha256.New, key)
+			_, _ = mac.Write([]byte("session encryption"))
+
+			block, err := aes.NewCipher(mac.Sum(nil))
+			if err != nil {
+				panic(err)
+			}
+
+			aead, err := cipher.NewGCM(block)
+			if err != nil {
+				panic(err)
+			}
+
+			m.aeads = append(m.aeads, aead)
+		}
+	}
+
+	if len(m.cookieName) == 0 {
+		m.cookieName = defaultSessionCookieName
+	}
+
+	if len(m.cookiePath) == 0 {
+		m.cookiePath = "/"
+	}
+
+	if m.cookieSameSite == 0 {
+		m.cookieSameSite = http.SameSiteLaxMode
+	}
+
+	if m.idleTimeout == 0 {
+		m.idleTimeout = defaultSessionIdleTimeout
+	}
+
+	if m.absoluteTimeout == 0 {
+		m.absoluteTimeout = defaultSessionAbsoluteTimeout
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *Session) Invoke(c *web.Context, next web.HandlerFunc) {
+	_, err := c.Request.Cookie(m.cookieName)
+	hasCookie := err == nil
+
+	session, rotated := m.load(c)
+	found := session != nil
+
+	if session == nil || m.expired(session) {
+		if session != nil && m.store != nil {
+			m.delete(c, session.ID)
+		}
+
+		session = web.NewSession()
+		session.CreatedAt = m.now()
+		found = false
+	}
+
+	session.AccessedAt = m.now()
+	c.Set(web.SessionKey, session)
+
+	saved := false
+	save := func(w http.ResponseWriter) {
+		if saved {
+			return
+		}
+		saved = true
+
+		switch {
+		case session.IsDestroyed():
+			if found {
+				m.delete(c, session.PreviousID())
+				m.delete(c, session.ID)
+				m.setCookie(w, "", -1)
+			}
+		case session.IsModified(), found && (rotated || m.idleTimeout > 0):
+			// the session is saved again to update the access time for the idle timeout
+			m.save(c, w, session)
+		case hasCookie && !found:
+			// the session was expired or the cookie was invalid
+			m.setCookie(w, "", -1)
+		}
+	}
+
+	c.Writer.Before(func(w web.ResponseWriter) {
+		save(w)
+	})
+
+	_ = next(c)
+
+	// the handler didn't write anything, so the hook wasn't called
+	if !c.Writer.Written() {
+		save(c.Writer)
+	}
+}
+
+// load returns the session of the cookie.  rotated is true if the cookie was signed by the old key.
+func (m *Session) load(c *web.Context) (*web.Session, bool) {
+	cookie, err := c.Request.Cookie(m.cookieName)
+	if err != nil || len(cookie.Value) == 0 {
+		return nil, false
+	}
+
+	data, rotated, err := m.decode(cookie.Value)
+	if err != nil {
+		return nil, false
+	}
+
+	if m.store != nil {
+		id := string(data)
+
+		data, found, err := m.store.Load(c.StdContext(), id)
+		if err != nil {
+			log.FromContext(c.StdContext()).Warn().Err(err).Msg("middleware: session store failed")
+			return nil, false
+		}
+
+		if !found {
+			return nil, false
+		}
+
+		session := &web.Session{}
+		if err := json.Unmarshal(data, session); err != nil || session.ID != id {
+			return nil, false
+		}
+
+		return session, rotated
+	}
+
+	session := &web.Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, false
+	}
+
+	return session, rotated
+}
+
+func (m *Session) expired(session *web.Session) bool {
+	now := m.now()
+
+	if m.idleTimeout > 0 && now.After(session.AccessedAt.Add(m.idleTimeout)) {
+		return true
+	}
+
+	if m.absoluteTimeout > 0 && now.After(session.CreatedAt.Add(m.absoluteTimeout)) {
+		return true
+	}
+
+	return false
+}
+
+// ttl returns the duration until the session expires.  Zero means the session doesn't expire.
+func (m *Session) ttl(session *web.Session) time.Duration {
+	var ttl time.Duration
+
+	if m.idleTimeout > 0 {
+		ttl = session.AccessedAt.Add(m.idleTimeout).Sub(m.now())
+	}
+
+	if m.absoluteTimeout > 0 {
+		absolute := session.CreatedAt.Add(m.absoluteTimeout).Sub(m.now())
+		if ttl == 0 || absolute < ttl {
+			ttl = absolute
+		}
+	}
+
+	return ttl
+}
+
+func (m *Session) save(c *web.Context, w http.ResponseWriter, session *web.Session) {
+	ctx := c.StdContext()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.FromContext(ctx).Warn().Err(err).Msg("middleware: session can't be encoded")
+		return
+	}
+
+	ttl := m.ttl(session)
+
+	if m.store != nil {
+		if previousID := session.PreviousID(); len(previousID) > 0 {
+			m.delete(c, previousID)
+		}
+
+		if err := m.store.Save(ctx, session.ID, data, ttl); err != nil {
+			log.FromContext(ctx).Warn().Err(err).Msg("middleware: session store failed")
+			return
+		}
+
+		data = []byte(session.ID)
+	}
+
+	value, err := m.encode(data)
+	if err != nil {
+		log.FromContext(ctx).Warn().Err(err).Msg("middleware: session can't be saved")
+		return
+	}
+
+	// the cookie expires with the session, so the browser doesn't send the expired session
+	maxAge := int(ttl.Round(time.Second).Seconds())
+	if ttl > 0 && maxAge == 0 {
+		maxAge = 1
+	}
+
+	m.setCookie(w, value, maxAge)
+}
+
+func (m *Session) delete(c *web.Context, id string) {
+	if m.store == nil || len(id) == 0 {
+		return
+	}
+
+	if err := m.store.Delete(c.StdContext(), id); err != nil {
+		log.FromContext(c.StdContext()).Warn().Err(err).Msg("middleware: session store failed")
+	}
+}
+
+func (m *Session) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     m.cookiePath,
+		Domain:   m.cookieDomain,
+		Secure:   m.cookieSecure,
+		HttpOnly: m.cookieHTTPOnly,
+		SameSite: m.cookieSameSite,
+	})
+}
+
+// encode signs or encrypts the data by the first key.  The cookie name is authenticated as well, so the value can't
+// be used by other cookies.
+func (m *Session) encode(data []byte) (string, error) {
+	var value string
+
+	if len(m.aeads) > 0 {
+		aead := m.aeads[0]
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+
+		value = base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, []byte(m.cookieName)))
+	} else {
+		payload := base64.RawURLEncoding.EncodeToString(data)
+		value = payload + "." + base64.RawURLEncoding.EncodeToString(m.sign(m.keys[0], payload))
+	}
+
+	if len(m.cookieName)+len(value) > maxSessionCookieSize {
+		return "", ErrSessionCookieTooLarge
+	}
+
+	return value, nil
+}
+
+// decode verifies or decrypts the value by all keys.  rotated is true if the value was encoded by the old key.
+func (m *Session) decode(value string) ([]byte, bool, error) {
+	if len(m.aeads) > 0 {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, false, ErrSessionCookieInvalid
+		}
+
+		for i, aead := range m.aeads {
+			if len(b) < aead.NonceSize() {
+				break
+			}
+
+			nonce, ciphertext := b[:aead.NonceSize()], b[aead.NonceSize():]
+			if data, err := aead.Open(nil, nonce, ciphertext, []byte(m.cookieName)); err == nil {
+				return data, i > 0, nil
+			}
+		}
+
+		return nil, false, ErrSessionCookieInvalid
+	}
+
+	payload, signature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, false, ErrSessionCookieInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, false, ErrSessionCookieInvalid
+	}
+
+	for i, key := range m.keys {
+		if hmac.Equal(sig, m.sign(key, payload)) {
+			data, err := base64.RawURLEncoding.DecodeString(payload)
+			if err != nil {
+				return nil, false, ErrSessionCookieInvalid
+			}
+			return data, i > 0, nil
+		}
+	}
+
+	return nil, false, ErrSessionCookieInvalid
+}
+
+func (m *Session) sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(m.cookieName + "." + payload))
+	return mac.Sum(nil)
+}
+
+// MemorySessionStore is an in-memory SessionStore.  The expired sessions are removed by the janitor of cache
+// package which runs until `Close` is called, ex: by `WebServer.OnShutdown`.
+type MemorySessionStore struct {
+	sessions  *cache.Cache[string, []byte]
+	closeOnce sync.Once
+}
+
+// NewMemorySessionStore returns MemorySessionStore instance
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: cache.NewCache[string, []byte](time.Minute),
+	}
+}
+
+// Load returns the session data of the id
+func (s *MemorySessionStore) Load(_ context.Context, id string) ([]byte, bool, error) {
+	data, found := s.sessions.Get(id)
+	return data, found, nil
+}
+
+// Save saves the session data with the ttl.  Zero ttl means the session doesn't expire.
+func (s *MemorySessionStore) Save(_ context.Context, id string, data []byte, ttl time.Duration) error {
+	s.sessions.PutWithTTL(id, data, ttl)
+	return nil
+}
+
+// Delete removes the session data of the id
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.sessions.Delete(id)
+	return nil
+}
+
+// Close stops the janitor of the store.  It is safe to call Close more than once.
+func (s *MemorySessionStore) Close() error {
+	s.closeOnce.Do(s.sessions.StopCleanup)
+	return nil
+}
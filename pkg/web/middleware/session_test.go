@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	sessionKey1 = bytes.Repeat([]byte("1"), 32)
+	sessionKey2 = bytes.Repeat([]byte("2"), 32)
+)
+
+func newSessionServer(m *Session) *web.WebServer {
+	s := web.NewServer()
+	s.Use(m)
+	s.Get("/login", func(c *web.Context) error {
+		session := c.Session()
+		session.Regenerate()
+		session.Set("user", c.Query("user"))
+		session.AddFlash("welcome")
+		return c.String(200, "ok")
+	})
+	s.Get("/me", func(c *web.Context) error {
+		session := c.Session()
+		flashes := session.Flashes()
+		if len(flashes) > 0 {
+			return c.String(200, session.GetString("user")+" "+flashes[0].(string))
+		}
+		return c.String(200, session.GetString("user"))
+	})
+	s.Get("/logout", func(c *web.Context) error {
+		c.Session().Destroy()
+		c.SetStatus(204)
+		return nil
+	})
+	return s
+}
+
+func sessionRequest(s *web.WebServer, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+func TestSessionCookie(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		s := newSessionServer(NewSession(SessionOptions{
+			Keys:           [][]byte{sessionKey1},
+			Encrypt:        encrypt,
+			CookieHTTPOnly: true,
+		}))
+
+		// the cookie isn't sent until the session is modified
+		w := sessionRequest(s, "/me", nil)
+		assert.Empty(t, w.Result().Cookies())
+
+		w = sessionRequest(s, "/login?user=john", nil)
+		cookie := sessionCookie(t, w)
+		assert.Equal(t, "session", cookie.Name)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+		assert.Equal(t, 1800, cookie.MaxAge)
+		assert.Equal(t, !encrypt, strings.Contains(cookie.Value, "."))
+
+		// the flash message is removed after it is read
+		w = sessionRequest(s, "/me", cookie)
+		assert.Equal(t, "john welcome", w.Body.String())
+		cookie = sessionCookie(t, w)
+
+		w = sessionRequest(s, "/me", cookie)
+		assert.Equal(t, "john", w.Body.String())
+
+		// the tampered cookie is ignored and removed
+		tampered := *cookie
+		tampered.Value = "A" + cookie.Value[1:]
+		if cookie.Value[0] == 'A' {
+			tampered.Value = "B" + cookie.Value[1:]
+		}
+		w = sessionRequest(s, "/me", &tampered)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, -1, sessionCookie(t, w).MaxAge)
+
+		w = sessionRequest(s, "/logout", cookie)
+		assert.Equal(t, 204, w.Code)
+		assert.Equal(t, -1, sessionCookie(t, w).MaxAge)
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	old := newSessionServer(NewSession(SessionOptions{Keys: [][]byte{sessionKey1}, IdleTimeout: -1}))
+	rotated := newSessionServer(NewSession(SessionOptions{Keys: [][]byte{sessionKey2, sessionKey1}, IdleTimeout: -1}))
+
+	cookie := sessionCookie(t, sessionRequest(old, "/login?user=john", nil))
+
+	// the cookie which was signed by the old key is signed again by the new key
+	w := sessionRequest(rotated, "/me", cookie)
+	assert.Equal(t, "john welcome", w.Body.String())
+	cookie = sessionCookie(t, w)
+
+	w = sessionRequest(old, "/me", cookie)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestSessionStore(t *testing.T) {
+	store := NewMemorySessionStore()
+	defer func() { assert.NoError(t, store.Close()) }()
+	m := NewSession(SessionOptions{Keys: [][]byte{sessionKey1}, Store: store})
+	s := newSessionServer(m)
+
+	w := sessionRequest(s, "/login?user=john", nil)
+	cookie := sessionCookie(t, w)
+
+	data, _, err := m.decode(cookie.Value)
+	require.NoError(t, err)
+	id := string(data)
+
+	_, found, _ := store.Load(context.Background(), id)
+	assert.True(t, found)
+
+	// the session id is changed after the user signs in again
+	w = sessionRequest(s, "/login?user=mary", cookie)
+	newCookie := sessionCookie(t, w)
+	assert.NotEqual(t, cookie.Value, newCookie.Value)
+	_, found, _ = store.Load(context.Background(), id)
+	assert.False(t, found)
+
+	w = sessionRequest(s, "/me", newCookie)
+	assert.Equal(t, "mary welcome", w.Body.String())
+
+	w = sessionRequest(s, "/logout", newCookie)
+	assert.Equal(t, -1, sessionCookie(t, w).MaxAge)
+
+	w = sessionRequest(s, "/me", newCookie)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestSessionExpiry(t *testing.T) {
+	m := NewSession(SessionOptions{
+		Keys:            [][]byte{sessionKey1},
+		IdleTimeout:     10 * time.Minute,
+		AbsoluteTimeout: time.Hour,
+	})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	s := newSessionServer(m)
+
+	cookie := sessionCookie(t, sessionRequest(s, "/login?user=john", nil))
+	assert.Equal(t, 600, cookie.MaxAge)
+
+	// the access time is updated, so the idle timeout is extended
+	for i := 0; i < 6; i++ {
+		now = now.Add(9 * time.Minute)
+		w := sessionRequest(s, "/me", cookie)
+		assert.Contains(t, w.Body.String(), "john")
+		cookie = sessionCookie(t, w)
+	}
+
+	// the absolute timeout limits the max age of the cookie
+	assert.Equal(t, 360, cookie.MaxAge)
+
+	now = now.Add(20 * time.Minute)
+	w := sessionRequest(s, "/me", cookie)
+	assert.Empty(t, w.Body.String())
+
+	cookie = sessionCookie(t, sessionRequest(s, "/login?user=john", nil))
+	now = now.Add(11 * time.Minute)
+	w = sessionRequest(s, "/me", cookie)
+	assert.Empty(t, w.Body.String())
+}
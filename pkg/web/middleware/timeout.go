@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+// TimeoutOptions is a configuration container to setup the timeout middleware.
+type TimeoutOptions struct {
+	// Timeout is the deadline of the handler.  Zero keeps the deadline of the outer timeout middleware.
+	Timeout time.Duration
+	// MaxRequestBodySize overrides `WebServer.MaxRequestBodySize`.  Zero keeps the current limit.
+	MaxRequestBodySize int64
+	// StatusCode is sent when the handler overruns the deadline.  It should be 503 or 504 and default value is 503.
+	StatusCode int
+	// Body is sent when the handler overruns the deadline.  Default value is a json HTTPError, ex:
+	// {"code": "timeout", "message": "Service Unavailable"}
+	Body []byte
+	// ContentType of the Body.  Default value is "application/json; charset=utf-8" if the Body is empty;
+	// otherwise, "text/plain; charset=utf-8".
+	ContentType string
+}
+
+type timeoutStateKey struct{}
+
+// timeoutState is shared by the nested timeout middleware of the request, so the inner middleware, ex: route
+// middleware, is able to override the deadline of the outer one.
+type timeoutState struct {
+	// parent is the request context before the first timeout middleware, it is canceled when the client disconnects
+	parent context.Context
+	writer *timeoutWriter
+	// stop prevents the current deadline from sending the timeout response
+	stop func() bool
+}
+
+// Timeout is a middleware which sets a deadline to the request context and limits the request body size.  The
+// handler should stop working once the context is done.  If the handler overruns the deadline, the timeout response
+// is sent and the later writes of the handler are discarded.  The timeout middleware of routes or groups overrides
+// the global one.
+type Timeout struct {
+	timeout            time.Duration
+	maxRequestBodySize int64
+	statusCode         int
+	body               []byte
+	contentType        string
+}
+
+// NewTimeout returns Timeout middleware instance
+func NewTimeout(options TimeoutOptions) *Timeout {
+	m := &Timeout{
+		timeout:            options.Timeout,
+		maxRequestBodySize: options.MaxRequestBodySize,
+		statusCode:         options.StatusCode,
+		body:               options.Body,
+		contentType:        options.ContentType,
+	}
+
+	if m.timeout < 0 {
+		panic("middleware: timeout can't be negative")
+	}
+
+	if m.statusCode == 0 {
+		m.statusCode = http.StatusServiceUnavailable
+	}
+
+	if len(m.body) == 0 {
+		m.body, _ = json.Marshal(web.NewHTTPError(m.statusCode).WithCode("timeout"))
+		if len(m.contentType) == 0 {
+			m.contentType = "application/json; charset=utf-8"
+		}
+	}
+
+	if len(m.contentType) == 0 {
+		m.contentType = "text/plain; charset=utf-8"
+	}
+
+	return m
+}
+
+// Invoke function is a middleware entry
+func (m *Timeout) Invoke(c *web.Context, next web.HandlerFunc) {
+	if m.maxRequestBodySize > 0 {
+		c.SetMaxRequestBodySize(m.maxRequestBodySize)
+	}
+
+	if m.timeout == 0 {
+		_ = next(c)
+		return
+	}
+
+	state, found := c.Request.Context().Value(timeoutStateKey{}).(*timeoutState)
+	if found {
+		// the response was already sent by the outer deadline
+		if !state.stop() {
+			_ = next(c)
+			return
+		}
+
+		cancel := m.start(c, state)
+		defer cancel()
+
+		_ = next(c)
+		return
+	}
+
+	w, req := c.Writer, c.Request
+	state = &timeoutState{
+		parent: req.Context(),
+		writer: newTimeoutWriter(w),
+	}
+	c.SetStdContext(context.WithValue(state.parent, timeoutStateKey{}, state))
+	c.Writer = state.writer
+
+	cancel := m.start(c, state)
+
+	defer func() {
+		// the error of the handler is rendered after the middleware returns, so the timeout response is sent first
+		state.writer.timeout()
+		cancel()
+		state.writer.finish()
+		c.Writer = w
+		c.Request = req
+	}()
+
+	_ = next(c)
+}
+
+// start sets the deadline to the request context.  The values of the current context are kept, but the
+// cancellation of the outer deadline is detached.  The request is restored when the returned function is called, so
+// the previous middleware don't see the canceled context.
+func (m *Timeout) start(c *web.Context, state *timeoutState) context.CancelFunc {
+	req := c.Request
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), m.timeout)
+	stopParent := context.AfterFunc(state.parent, cancel)
+
+	state.writer.setDeadline(ctx, m)
+	state.stop = context.AfterFunc(ctx, state.writer.timeout)
+
+	c.SetStdContext(ctx)
+
+	return func() {
+		state.stop()
+		stopParent()
+		cancel()
+		c.Request = req
+	}
+}
+
+// timeoutWriter guards the writer, so the handler and the timer don't write the response at the same time.  The
+// handler has its own header map which is copied to the original writer when the header is written.
+type timeoutWriter struct {
+	web.ResponseWriter
+	mu          sync.Mutex
+	header      http.Header
+	wroteHeader bool
+	timedOut    bool
+	// ctx is the context of the current deadline and m sends the timeout response
+	ctx context.Context
+	m   *Timeout
+}
+
+func newTimeoutWriter(w web.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		ResponseWriter: w,
+		header:         w.Header().Clone(),
+	}
+}
+
+// Header returns the header map of the handler
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader copies the header of the handler and writes the status code
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.exceeded() || tw.wroteHeader {
+		return
+	}
+
+	tw.writeHeader(statusCode)
+}
+
+func (tw *timeoutWriter) setDeadline(ctx context.Context, m *Timeout) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.ctx = ctx
+	tw.m = m
+}
+
+// exceeded sends the timeout response if the deadline was exceeded.  The timer may not have fired yet when the
+// handler returns the error of the context, so the writes check the deadline as well.
+func (tw *timeoutWriter) exceeded() bool {
+	if !tw.timedOut && tw.ctx != nil && tw.ctx.Err() == context.DeadlineExceeded {
+		tw.writeTimeout()
+	}
+	return tw.timedOut
+}
+
+func (tw *timeoutWriter) writeHeader(statusCode int) {
+	dst := tw.ResponseWriter.Header()
+
+	for key := range dst {
+		if _, found := tw.header[key]; !found {
+			delete(dst, key)
+		}
+	}
+
+	for key, values := range tw.header {
+		dst[key] = values
+	}
+
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write returns http.ErrHandlerTimeout if the deadline was exceeded
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.exceeded() {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush sends the buffered data to the client
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.exceeded() {
+		return
+	}
+
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+
+	tw.ResponseWriter.Flush()
+}
+
+// Status returns http status code
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.ResponseWriter.Status()
+}
+
+// Written returns true if the response header has been written
+func (tw *timeoutWriter) Written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.exceeded() || tw.wroteHeader || tw.ResponseWriter.Written()
+}
+
+// Unwrap returns the wrapped writer, so http.NewResponseController is able to find the optional interfaces
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// timeout is called when the context of the current deadline is done
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.exceeded()
+}
+
+// writeTimeout sends the timeout response if the handler didn't write the header yet
+func (tw *timeoutWriter) writeTimeout() {
+	tw.timedOut = true
+
+	if tw.wroteHeader || tw.ResponseWriter.Written() {
+		return
+	}
+
+	header := tw.ResponseWriter.Header()
+	header.Set(headerContentType, tw.m.contentType)
+	header.Set(headerContentLength, strconv.Itoa(len(tw.m.body)))
+	header.Del(headerContentEncoding)
+
+	tw.ResponseWriter.WriteHeader(tw.m.statusCode)
+	_, _ = tw.ResponseWriter.Write(tw.m.body)
+	// the handler is still running, so the response is flushed to the client immediately
+	tw.ResponseWriter.Flush()
+}
+
+// finish copies the header of the handler which didn't write anything, ex: the status code was set by
+// `Context.SetStatus` without body
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+
+	dst := tw.ResponseWriter.Header()
+	for key, values := range tw.header {
+		dst[key] = values
+	}
+}
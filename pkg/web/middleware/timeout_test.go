@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nite-coder/blackbear/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeout(t *testing.T) {
+	s := web.NewServer()
+
+	// the request context is restored after the timeout middleware returns
+	restored := make(chan error, 1)
+	s.UseFunc(func(c *web.Context, next web.HandlerFunc) {
+		_ = next(c)
+		if _, found := c.StdContext().Deadline(); found {
+			restored <- errors.New("the deadline wasn't removed")
+			return
+		}
+		restored <- c.StdContext().Err()
+	})
+	s.Use(NewTimeout(TimeoutOptions{Timeout: 20 * time.Millisecond}))
+
+	lateWrite := make(chan error, 1)
+	s.Get("/slow", func(c *web.Context) error {
+		<-c.StdContext().Done()
+		_, err := c.Writer.Write([]byte("late"))
+		lateWrite <- err
+		return c.StdContext().Err()
+	})
+	s.Get("/fast", func(c *web.Context) error {
+		_, found := c.StdContext().Deadline()
+		assert.True(t, found)
+		c.RespHeader("X-Fast", "1")
+		return c.String(200, "fast")
+	})
+	s.Get("/upstream", func(c *web.Context) error {
+		select {
+		case <-time.After(5 * time.Millisecond):
+			return c.String(200, "ok")
+		case <-c.StdContext().Done():
+			return c.StdContext().Err()
+		}
+	}, NewTimeout(TimeoutOptions{
+		Timeout:     time.Millisecond,
+		StatusCode:  http.StatusGatewayTimeout,
+		Body:        []byte("upstream timeout"),
+		ContentType: "text/plain",
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"code":"timeout","message":"Service Unavailable"}`, w.Body.String())
+	assert.ErrorIs(t, <-lateWrite, http.ErrHandlerTimeout)
+	assert.NoError(t, <-restored)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/fast", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Fast"))
+	assert.Equal(t, "fast", w.Body.String())
+	assert.NoError(t, <-restored)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/upstream", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 504, w.Code)
+	assert.Equal(t, "upstream timeout", w.Body.String())
+	assert.NoError(t, <-restored)
+}
+
+func TestTimeoutOverride(t *testing.T) {
+	s := web.NewServer()
+	s.MaxRequestBodySize = 10
+	s.Use(NewTimeout(TimeoutOptions{Timeout: 10 * time.Millisecond}))
+
+	upload := s.Group("/upload", NewTimeout(TimeoutOptions{
+		Timeout:            time.Second,
+		MaxRequestBodySize: 100,
+	}))
+
+	handler := func(c *web.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-c.StdContext().Done():
+			return c.StdContext().Err()
+		}
+
+		b, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return web.NewHTTPError(http.StatusRequestEntityTooLarge).Wrap(err)
+		}
+		return c.String(200, string(b))
+	}
+	s.Post("/", handler)
+	upload.Post("/", handler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("hello"))
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 503, w.Code)
+
+	body := strings.Repeat("a", 50)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/upload", strings.NewReader(body))
+	s.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	assert.Equal(t, body, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("a", 200)))
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 413, w.Code)
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/nite-coder/blackbear/pkg/web"
+)
+
+// handleError passes the error to `WebServer.ErrorHandler`
+func handleError(c *web.Context, err error) {
+	errorHandler := c.WebServer.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = web.DefaultErrorHandler
+	}
+
+	errorHandler(c, err)
+}
@@ -0,0 +1,177 @@
+package web
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/nite-coder/blackbear/pkg/log"
+)
+
+// trustedProxies returns the parsed `TrustedProxies`.  They are parsed once, so the field must be set before the
+// server starts.
+func (s *WebServer) trustedProxies() []netip.Prefix {
+	s.trustedProxiesOnce.Do(func() {
+		for _, proxy := range s.TrustedProxies {
+			proxy = strings.TrimSpace(proxy)
+
+			if prefix, err := netip.ParsePrefix(proxy); err == nil {
+				s.trustedPrefixes = append(s.trustedPrefixes, prefix.Masked())
+				continue
+			}
+
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				log.Warn().Str("proxy", proxy).Msg("web: trusted proxy is not a valid ip or cidr")
+				continue
+			}
+
+			addr = addr.Unmap()
+			s.trustedPrefixes = append(s.trustedPrefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	})
+
+	return s.trustedPrefixes
+}
+
+// isTrustedProxy returns true if the address is in `TrustedProxies`
+func (s *WebServer) isTrustedProxy(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range s.trustedProxies() {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteAddr returns the address of the peer which sent the request
+func (c *Context) remoteAddr() netip.Addr {
+	return parseNode(c.Request.RemoteAddr)
+}
+
+// fromTrustedProxy returns true if the request was sent by a trusted proxy, so the forwarded headers can be used
+func (c *Context) fromTrustedProxy() bool {
+	return c.WebServer != nil && c.WebServer.isTrustedProxy(c.remoteAddr())
+}
+
+// forwardedParams returns the values of the parameter of `Forwarded` header, ex: for, proto, host.  The values are
+// in the order of the proxies and empty value means the element doesn't have the parameter.
+func forwardedParams(header []string, name string) []string {
+	var values []string
+
+	for _, line := range header {
+		for _, element := range splitQuoted(line, ',') {
+			value := ""
+
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(strings.TrimSpace(key), name) {
+					value = strings.Trim(strings.TrimSpace(val), `"`)
+				}
+			}
+
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// splitQuoted splits the string by the separator which is not quoted
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// headerValues returns the comma-separated values of the header
+func headerValues(header []string) []string {
+	var values []string
+
+	for _, line := range header {
+		for _, value := range strings.Split(line, ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+
+	return values
+}
+
+// parseNode parses the ip of the node which may have a port, ex: "192.0.2.1:8080" or "[2001:db8::1]:8080".
+// The invalid address is returned if the node is obfuscated or unknown.
+func parseNode(node string) netip.Addr {
+	node = strings.TrimSpace(node)
+
+	if addr, err := netip.ParseAddr(node); err == nil {
+		return addr.Unmap()
+	}
+
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			return addr.Unmap()
+		}
+	}
+
+	// ipv6 without port in Forwarded header, ex: "[2001:db8::1]"
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")); err == nil {
+		return addr.Unmap()
+	}
+
+	return netip.Addr{}
+}
+
+// forwardedValue returns the value of the X-Forwarded-* header, or the parameter of Forwarded header if the header
+// is empty, which was added by the farthest trusted proxy.  The proxy appends the value when it appends the address
+// of the previous hop, so the hops are walked from right to left until the hop isn't trusted.  The values on the
+// left may be sent by the client.  The last value is used if the values don't match the hops, ex: the proxy
+// overwrites the header.
+func (c *Context) forwardedValue(header string, param string) string {
+	values := headerValues(c.Request.Header.Values(header))
+	hops := headerValues(c.Request.Header.Values("X-Forwarded-For"))
+
+	if len(values) == 0 {
+		forwarded := c.Request.Header.Values("Forwarded")
+		values = forwardedParams(forwarded, param)
+		hops = forwardedParams(forwarded, "for")
+	}
+
+	if len(values) == 0 {
+		return ""
+	}
+
+	i := len(values) - 1
+	if len(values) != len(hops) {
+		return values[i]
+	}
+
+	for ; i > 0; i-- {
+		addr := parseNode(hops[i])
+		if !addr.IsValid() || !c.WebServer.isTrustedProxy(addr) {
+			break
+		}
+	}
+
+	return values[i]
+}
@@ -0,0 +1,361 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nite-coder/blackbear/pkg/log"
+)
+
+var (
+	// ErrRendererNotSet is returned by `Context.Render` if `WebServer.Renderer` is nil
+	ErrRendererNotSet = errors.New("web: renderer is not set")
+	// ErrViewNotFound is returned by `HTMLRenderer` if the view doesn't exist
+	ErrViewNotFound = errors.New("web: view not found")
+)
+
+// Renderer renders the view for `Context.Render`.  Implement the interface to use other template engines.
+type Renderer interface {
+	Render(w io.Writer, name string, data interface{}, c *Context) error
+}
+
+// HTMLRendererOptions is a configuration container to setup HTMLRenderer.  The templates are organized in three
+// directories:
+//
+//   - shares: the partials which are available to all views and layouts, ex: {{ template "header.html" . }}
+//   - layouts: the layouts which wrap the views.  The view is rendered by {{ template "content" . }}
+//   - views: the views which are rendered by their path, ex: "users/index.html"
+type HTMLRendererOptions struct {
+	// Dir is the root directory of the templates
+	Dir string
+	// FS is the root of the templates, ex: embed.FS.  Default value is os.DirFS(Dir)
+	FS fs.FS
+	// Extension filters the template files, ex: ".html".  All files are templates if it is empty.
+	Extension string
+	// Layout is the default layout in the layouts directory, ex: "main.html".  The views are rendered without
+	// layout if it is empty.
+	Layout string
+	// Funcs are available to all templates.  `urlfor`, `cspNonce` and `csrfToken` are added by default.
+	Funcs template.FuncMap
+	// Reload parses the templates again after the files are changed, so it should only be used in development.
+	// Dir is watched for changes and the templates are parsed for every request if Dir is empty.
+	Reload bool
+}
+
+// HTMLRenderer is the default Renderer which uses html/template.  The templates are parsed once and the parsed
+// templates are reused by the requests.
+type HTMLRenderer struct {
+	fsys      fs.FS
+	dir       string
+	extension string
+	layout    string
+	funcs     template.FuncMap
+	reload    bool
+
+	mu      sync.RWMutex
+	views   map[string]*view
+	dirty   atomic.Bool
+	watcher *fsnotify.Watcher
+}
+
+// view is a parsed view which is never executed, so it can be cloned.  The clones are executed and reused by
+// the pool, because html/template escapes the template when it is executed for the first time.
+type view struct {
+	tmpl  *template.Template
+	entry string
+	pool  sync.Pool
+}
+
+// viewInstance is a clone of the view.  The functions of the clone read the context from the state, so a clone
+// is only used by one request at a time.
+type viewInstance struct {
+	tmpl  *template.Template
+	state *renderState
+}
+
+type renderState struct {
+	c *Context
+}
+
+// NewHTMLRenderer parses the templates and returns HTMLRenderer instance
+func NewHTMLRenderer(options HTMLRendererOptions) (*HTMLRenderer, error) {
+	r := &HTMLRenderer{
+		fsys:      options.FS,
+		dir:       options.Dir,
+		extension: options.Extension,
+		layout:    options.Layout,
+		funcs:     template.FuncMap{},
+		reload:    options.Reload,
+	}
+
+	if r.fsys == nil {
+		if len(r.dir) == 0 {
+			return nil, errors.New("web: Dir or FS of the renderer must be set")
+		}
+		r.fsys = os.DirFS(r.dir)
+	}
+
+	for name, fn := range (&renderState{}).funcs() {
+		r.funcs[name] = fn
+	}
+
+	for name, fn := range options.Funcs {
+		r.funcs[name] = fn
+	}
+
+	views, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.views = views
+
+	if r.reload && len(r.dir) > 0 {
+		if err := r.watch(); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Render executes the view and writes the result to the writer
+func (r *HTMLRenderer) Render(w io.Writer, name string, data interface{}, c *Context) error {
+	if r.reload && (r.watcher == nil || r.dirty.Swap(false)) {
+		views, err := r.load()
+		if err != nil {
+			r.dirty.Store(true)
+			return err
+		}
+
+		r.mu.Lock()
+		r.views = views
+		r.mu.Unlock()
+	}
+
+	r.mu.RLock()
+	v, found := r.views[name]
+	r.mu.RUnlock()
+
+	if !found {
+		return fmt.Errorf("%w: %s", ErrViewNotFound, name)
+	}
+
+	inst, err := v.instance()
+	if err != nil {
+		return err
+	}
+
+	inst.state.c = c
+	defer func() {
+		inst.state.c = nil
+		v.pool.Put(inst)
+	}()
+
+	return inst.tmpl.ExecuteTemplate(w, v.entry, data)
+}
+
+// Close stops watching the template files
+func (r *HTMLRenderer) Close() error {
+	if r.watcher != nil {
+		return r.watcher.Close()
+	}
+	return nil
+}
+
+// load parses all templates.  The shared templates and the layout are parsed once and cloned for each view, so
+// the views are able to override the blocks of the layout.
+func (r *HTMLRenderer) load() (map[string]*view, error) {
+	base := template.New("").Funcs(r.funcs)
+
+	err := r.walk("shares", func(name string, text string) error {
+		_, err := base.New(name).Parse(text)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	layoutName := ""
+	if len(r.layout) > 0 {
+		layoutName = path.Join("layouts", r.layout)
+
+		b, err := fs.ReadFile(r.fsys, layoutName)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := base.New(layoutName).Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+
+	views := map[string]*view{}
+
+	err = r.walk("views", func(name string, text string) error {
+		t, err := base.Clone()
+		if err != nil {
+			return err
+		}
+
+		if _, err := t.New(name).Parse(text); err != nil {
+			return err
+		}
+
+		v := &view{tmpl: t, entry: name}
+
+		if len(layoutName) > 0 {
+			if _, err := t.New("content").Parse(text); err != nil {
+				return err
+			}
+			v.entry = layoutName
+		}
+
+		views[name] = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return views, nil
+}
+
+// walk calls the function with the name and the content of the template files in the directory.  The name is
+// the path which is relative to the directory.
+func (r *HTMLRenderer) walk(dir string, fn func(name string, text string) error) error {
+	err := fs.WalkDir(r.fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || !strings.HasSuffix(d.Name(), r.extension) {
+			return nil
+		}
+
+		b, err := fs.ReadFile(r.fsys, p)
+		if err != nil {
+			return err
+		}
+
+		return fn(strings.TrimPrefix(p, dir+"/"), string(b))
+	})
+
+	// the directory is optional
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// watch marks the templates dirty when the files in Dir are changed
+func (r *HTMLRenderer) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(r.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return watcher.Add(p)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	r.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// the new directory is watched as well
+				if event.Op&fsnotify.Create != 0 {
+					if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+						_ = watcher.Add(event.Name)
+					}
+				}
+
+				r.dirty.Store(true)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("web: template watcher failed")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// instance returns a clone of the view from the pool
+func (v *view) instance() (*viewInstance, error) {
+	if inst, ok := v.pool.Get().(*viewInstance); ok {
+		return inst, nil
+	}
+
+	t, err := v.tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &renderState{}
+	t.Funcs(state.funcs())
+
+	return &viewInstance{tmpl: t, state: state}, nil
+}
+
+// funcs returns the functions which depend on the context of the request
+func (state *renderState) funcs() template.FuncMap {
+	return template.FuncMap{
+		"urlfor": func(name string, params ...interface{}) (string, error) {
+			if state.c == nil {
+				return "", fmt.Errorf("%w: %s", ErrRouteNotFound, name)
+			}
+			return state.c.WebServer.URLFor(name, params...)
+		},
+		"cspNonce": func() string {
+			if state.c == nil {
+				return ""
+			}
+			return state.c.CSPNonce()
+		},
+		"csrfToken": func() string {
+			if state.c == nil {
+				return ""
+			}
+			return state.c.CSRFToken()
+		},
+	}
+}
+
+// templateRenderer renders the template which is set by `WebServer.SetTemplate`
+type templateRenderer struct {
+	tmpl *template.Template
+}
+
+func (r *templateRenderer) Render(w io.Writer, name string, data interface{}, _ *Context) error {
+	return r.tmpl.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLRenderer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shares/header.html": {Data: []byte(`<h1>{{ upper .Title }}</h1>`)},
+		"layouts/main.html": {Data: []byte(
+			`<title>{{ block "title" . }}default{{ end }}</title>{{ template "header.html" . }}{{ template "content" . }}`)},
+		"views/index.html":       {Data: []byte(`{{ define "title" }}home{{ end }}<p>{{ .Body }}</p>`)},
+		"views/users/list.html":  {Data: []byte(`<a href="{{ urlfor "user" 1 }}">{{ .Body }}</a>`)},
+		"views/broken.html":      {Data: []byte(`{{ .Body.Missing }}`)},
+		"views/.hidden.html.swp": {Data: []byte(`{{`)},
+	}
+
+	renderer, err := NewHTMLRenderer(HTMLRendererOptions{
+		FS:     fsys,
+		Layout: "main.html",
+		Funcs: template.FuncMap{
+			"upper": strings.ToUpper,
+		},
+	})
+	require.NoError(t, err)
+
+	s := NewServer()
+	s.Renderer = renderer
+	s.Get("/users/:id", func(c *Context) error {
+		return nil
+	}).Name("user")
+	s.Get("/:view", func(c *Context) error {
+		data := map[string]string{"Title": "hello", "Body": "<b>world</b>"}
+		return c.Render(200, strings.ReplaceAll(c.Param("view"), "-", "/")+".html", data)
+	})
+
+	testCases := []struct {
+		view     string
+		status   int
+		expected string
+	}{
+		{"index", 200, `<title>home</title><h1>HELLO</h1><p>&lt;b&gt;world&lt;/b&gt;</p>`},
+		{"users-list", 200, `<title>default</title><h1>HELLO</h1><a href="/users/1">&lt;b&gt;world&lt;/b&gt;</a>`},
+		{"broken", 500, `{"message":"Internal Server Error"}`},
+		{"missing", 500, `{"message":"Internal Server Error"}`},
+	}
+
+	// the parsed templates are reused by the requests
+	for i := 0; i < 2; i++ {
+		for _, tc := range testCases {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/"+tc.view, nil)
+			s.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.status, w.Code, tc.view)
+			assert.Equal(t, tc.expected, w.Body.String(), tc.view)
+		}
+	}
+}
+
+func TestSetRender(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "views"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "views", "index.html"), []byte(`hello {{ . }}`), 0o600))
+
+	// shares directory doesn't exist
+	s := NewServer()
+	s.SetRender(dir)
+	s.Get("/", func(c *Context) error {
+		return c.Render(200, "index.html", "world")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "hello world", w.Body.String())
+
+	assert.Panics(t, func() {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "views", "broken.html"), []byte(`{{`), 0o600))
+		s.SetRender(dir)
+	})
+}
+
+func TestHTMLRendererReload(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "views"), 0o755))
+	view := filepath.Join(dir, "views", "index.html")
+	require.NoError(t, os.WriteFile(view, []byte(`v1`), 0o600))
+
+	renderer, err := NewHTMLRenderer(HTMLRendererOptions{Dir: dir, Reload: true})
+	require.NoError(t, err)
+	defer renderer.Close()
+
+	render := func() string {
+		var sb strings.Builder
+		require.NoError(t, renderer.Render(&sb, "index.html", nil, nil))
+		return sb.String()
+	}
+
+	assert.Equal(t, "v1", render())
+
+	require.NoError(t, os.WriteFile(view, []byte(`v2`), 0o600))
+	assert.Eventually(t, func() bool {
+		return render() == "v2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSetTemplate(t *testing.T) {
+	s := NewServer()
+	s.Get("/", func(c *Context) error {
+		return c.Render(200, "index", "world")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+
+	s.SetTemplate(template.Must(template.New("index").Parse(`hello {{ . }}`)))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "hello world", w.Body.String())
+}
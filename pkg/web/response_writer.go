@@ -2,8 +2,10 @@ package web
 
 import (
 	"bufio"
+	"io"
 	"net"
 	"net/http"
+	"time"
 )
 
 const (
@@ -14,8 +16,16 @@ const (
 // ResponseWriter wraps the original http.ResponseWriter
 type ResponseWriter interface {
 	http.ResponseWriter
+	http.Flusher
 	ContentLength() int
 	Status() int
+	Written() bool
+	// Before registers a hook which is called just before the header is written, so middleware can mutate
+	// the header at the last moment.  The hook can change the status code by calling WriteHeader.
+	Before(hook func(w ResponseWriter))
+	// Unwrap returns the original http.ResponseWriter, so http.NewResponseController is able to find the
+	// optional interfaces.
+	Unwrap() http.ResponseWriter
 	reset(writer http.ResponseWriter) ResponseWriter
 }
 
@@ -24,6 +34,8 @@ type responseWriter struct {
 	committed     bool
 	status        int
 	contentLength int
+	beforeHooks   []func(w ResponseWriter)
+	runningHooks  bool
 }
 
 // newResponseWriter returns a ResponseWriter which wraps the writer
@@ -44,15 +56,24 @@ func (rw *responseWriter) Status() int {
 	return rw.status
 }
 
+// Written returns true if the response header has been written
+func (rw *responseWriter) Written() bool {
+	return rw.committed
+}
+
 func (rw *responseWriter) Write(b []byte) (int, error) {
 	if !rw.committed {
 		// The status will be StatusOK if WriteHeader has not been called yet
 		rw.WriteHeader(http.StatusOK)
 	}
 
+	if rw.contentLength == noWritten {
+		rw.contentLength = 0
+	}
+
 	n, err := rw.ResponseWriter.Write(b)
 	rw.contentLength += n
-	
+
 	return n, err
 }
 
@@ -64,15 +85,120 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
 
 	// Store the status code
 	rw.status = statusCode
-	rw.ResponseWriter.WriteHeader(statusCode)
+
+	// the hook changes the status code only, the header is written after all hooks are called
+	if rw.runningHooks {
+		return
+	}
+
+	if len(rw.beforeHooks) > 0 {
+		hooks := rw.beforeHooks
+		rw.beforeHooks = nil
+		rw.runningHooks = true
+
+		// the hooks are called in reverse order, so the hook which was registered first is called last
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i](rw)
+		}
+
+		rw.runningHooks = false
+	}
+
+	rw.ResponseWriter.WriteHeader(rw.status)
 	rw.committed = true
 }
 
+// Before registers a hook which is called just before the header is written
+func (rw *responseWriter) Before(hook func(w ResponseWriter)) {
+	rw.beforeHooks = append(rw.beforeHooks, hook)
+}
+
+// Unwrap returns the original http.ResponseWriter
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush implements the http.Flusher interface to allow a HTTP handler to flush buffered data to the client.
+// The header is written with the current status if it has not been written yet.
+func (rw *responseWriter) Flush() {
+	if !rw.committed {
+		rw.WriteHeader(rw.status)
+	}
+
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 // Hijack implements the http.Hijacker interface to allow a HTTP handler to
-// take over the connection.
+// take over the connection.  http.ErrNotSupported is returned if the original
+// writer doesn't support it, ex: HTTP/2.
 // See https://golang.org/pkg/net/http/#Hijacker
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return rw.ResponseWriter.(http.Hijacker).Hijack()
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err == nil {
+		// nothing can be written by the writer after the connection is hijacked
+		rw.committed = true
+	}
+
+	return conn, brw, err
+}
+
+// Push implements the http.Pusher interface for HTTP/2 server push.  http.ErrNotSupported is returned if the
+// original writer doesn't support it.
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := rw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+// ReadFrom implements the io.ReaderFrom interface, so the original writer is able to use sendfile when
+// the reader is a file.
+func (rw *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !rw.committed {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	if rw.contentLength == noWritten {
+		rw.contentLength = 0
+	}
+
+	var (
+		n   int64
+		err error
+	)
+
+	if readerFrom, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{rw.ResponseWriter}, r)
+	}
+
+	rw.contentLength += int(n)
+
+	return n, err
+}
+
+// SetReadDeadline sets the deadline for reading the entire request, including the body.
+func (rw *responseWriter) SetReadDeadline(deadline time.Time) error {
+	return http.NewResponseController(rw.ResponseWriter).SetReadDeadline(deadline)
+}
+
+// SetWriteDeadline sets the deadline for writing the response.  A zero value means no deadline.
+func (rw *responseWriter) SetWriteDeadline(deadline time.Time) error {
+	return http.NewResponseController(rw.ResponseWriter).SetWriteDeadline(deadline)
+}
+
+// writerOnly hides the ReadFrom method of the writer to avoid infinite recursion in io.Copy
+type writerOnly struct {
+	io.Writer
 }
 
 func (rw *responseWriter) reset(writer http.ResponseWriter) ResponseWriter {
@@ -80,5 +206,7 @@ func (rw *responseWriter) reset(writer http.ResponseWriter) ResponseWriter {
 	rw.contentLength = noWritten
 	rw.status = defaultStatus
 	rw.committed = false
+	rw.beforeHooks = nil
+	rw.runningHooks = false
 	return rw
 }
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseWriterBeforeHooks(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := newResponseWriter().reset(w)
+
+	var order []string
+
+	rw.Before(func(w ResponseWriter) {
+		order = append(order, "first")
+		w.Header().Set("X-Status", http.StatusText(w.Status()))
+	})
+	rw.Before(func(w ResponseWriter) {
+		order = append(order, "second")
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	_, _ = rw.Write([]byte("hello"))
+
+	assert.Equal(t, []string{"second", "first"}, order)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "Accepted", w.Header().Get("X-Status"))
+	assert.Equal(t, http.StatusAccepted, rw.Status())
+
+	// hooks are removed when the writer is reset
+	w = httptest.NewRecorder()
+	rw = rw.reset(w)
+	rw.Before(func(w ResponseWriter) {
+		order = append(order, "third")
+		w.Header().Set("X-Status", http.StatusText(w.Status()))
+	})
+	rw.WriteHeader(http.StatusCreated)
+
+	assert.Equal(t, []string{"second", "first", "third"}, order)
+	assert.Equal(t, "Created", w.Header().Get("X-Status"))
+}
+
+func TestResponseWriterOptionalInterfaces(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := newResponseWriter().reset(w)
+
+	// httptest.ResponseRecorder doesn't support them
+	_, _, err := http.NewResponseController(rw).Hijack()
+	assert.True(t, errors.Is(err, http.ErrNotSupported))
+	assert.True(t, errors.Is(rw.(http.Pusher).Push("/app.js", nil), http.ErrNotSupported))
+
+	n, err := rw.(*responseWriter).ReadFrom(strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, 5, rw.ContentLength())
+
+	assert.NoError(t, http.NewResponseController(rw).Flush())
+	assert.True(t, w.Flushed)
+	assert.Equal(t, w, rw.Unwrap())
+}
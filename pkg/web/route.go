@@ -0,0 +1,142 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/nite-coder/blackbear/pkg/cast"
+)
+
+// ErrRouteNotFound is returned by URLFor when the route name was not registered
+var ErrRouteNotFound = errors.New("router: route was not found")
+
+// Route is a registered route.  It allows user to give the route a name, so the url can be built by `URLFor`.
+type Route struct {
+	router  *router
+	method  string
+	path    string
+	name    string
+	handler string
+}
+
+// RouteInfo represents the information of a registered route
+type RouteInfo struct {
+	Method  string
+	Path    string
+	Name    string
+	Handler string
+}
+
+// Name sets the name of the route.  The name must be unique.
+func (rt *Route) Name(name string) *Route {
+	if exist, found := rt.router.names[name]; found && exist != rt {
+		panic("router: route name '" + name + "' was already registered")
+	}
+
+	if len(rt.name) > 0 {
+		delete(rt.router.names, rt.name)
+	}
+
+	rt.name = name
+	rt.router.names[name] = rt
+
+	return rt
+}
+
+// Routes returns all registered routes in the order they were added
+func (s *WebServer) Routes() []RouteInfo {
+	result := make([]RouteInfo, 0, len(s.router.routes))
+
+	for _, rt := range s.router.routes {
+		result = append(result, RouteInfo{
+			Method:  rt.method,
+			Path:    rt.path,
+			Name:    rt.name,
+			Handler: rt.handler,
+		})
+	}
+
+	return result
+}
+
+// URLFor builds the path of the named route.  The `params` replace the `:param` and `*wildcard` segments in order.
+func (s *WebServer) URLFor(name string, params ...interface{}) (string, error) {
+	rt, found := s.router.names[name]
+	if !found {
+		return "", fmt.Errorf("%w: %s", ErrRouteNotFound, name)
+	}
+
+	segments := strings.Split(rt.path, "/")
+	index := 0
+
+	for i, segment := range segments {
+		if len(segment) == 0 || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+
+		if index >= len(params) {
+			pName, _ := parseParam(segment[1:])
+			return "", fmt.Errorf("router: missing parameter '%s' for route '%s'", pName, name)
+		}
+
+		val, err := cast.ToString(params[index])
+		if err != nil {
+			return "", err
+		}
+
+		if segment[0] == ':' {
+			val = url.PathEscape(val)
+		}
+
+		segments[i] = val
+		index++
+	}
+
+	if index != len(params) {
+		return "", fmt.Errorf("router: too many parameters for route '%s'", name)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// addRoute records the route information.  The route is replaced if the method and path were registered before.
+func (r *router) addRoute(method string, path string, handler HandlerFunc) *Route {
+	rt := &Route{
+		router:  r,
+		method:  method,
+		path:    path,
+		handler: handlerName(handler),
+	}
+
+	for i, exist := range r.routes {
+		if exist.method == method && exist.path == path {
+			if len(exist.name) > 0 {
+				rt.name = exist.name
+				r.names[exist.name] = rt
+			}
+
+			r.routes[i] = rt
+			return rt
+		}
+	}
+
+	r.routes = append(r.routes, rt)
+	return rt
+}
+
+func handlerName(h HandlerFunc) string {
+	if h == nil {
+		return ""
+	}
+
+	fn := runtime.FuncForPC(reflect.ValueOf(h).Pointer())
+	if fn == nil {
+		return ""
+	}
+
+	return fn.Name()
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func showUser(c *Context) error {
+	return c.String(200, c.Param("id"))
+}
+
+func TestRoutes(t *testing.T) {
+	_, _, s := createTestContext()
+
+	s.Get("/users/:id", showUser).Name("user.show")
+	s.Post("/users", showUser)
+	s.Group("/admin").Delete("/users/:id", showUser)
+
+	routes := s.Routes()
+	assert.Len(t, routes, 3)
+
+	assert.Equal(t, http.MethodGet, routes[0].Method)
+	assert.Equal(t, "/users/:id", routes[0].Path)
+	assert.Equal(t, "user.show", routes[0].Name)
+	assert.Equal(t, "github.com/nite-coder/blackbear/pkg/web.showUser", routes[0].Handler)
+
+	assert.Equal(t, http.MethodDelete, routes[2].Method)
+	assert.Equal(t, "/admin/users/:id", routes[2].Path)
+
+	// register the same route again should replace the route
+	s.Get("/users/:id", showUser)
+	assert.Len(t, s.Routes(), 3)
+	assert.Equal(t, "user.show", s.Routes()[0].Name)
+}
+
+func TestURLFor(t *testing.T) {
+	_, _, s := createTestContext()
+
+	s.Get("/users/:id", showUser).Name("user.show")
+	s.Get("/v1/:org/files/*path", showUser).Name("file.show")
+
+	url, err := s.URLFor("user.show", 123)
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/123", url)
+
+	url, err = s.URLFor("file.show", "nite coder", "images/ball.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1/nite%20coder/files/images/ball.jpg", url)
+
+	_, err = s.URLFor("file.show", "nite")
+	assert.Error(t, err)
+
+	_, err = s.URLFor("user.show", 1, 2)
+	assert.Error(t, err)
+
+	_, err = s.URLFor("unknown")
+	assert.True(t, errors.Is(err, ErrRouteNotFound))
+
+	assert.Panics(t, func() {
+		s.Post("/users", showUser).Name("user.show")
+	})
+}
+
+func TestURLForWithConstraint(t *testing.T) {
+	_, _, s := createTestContext()
+
+	s.Get("/users/:id<int>/posts/:slug<[a-z-]+>", showUser).Name("post.show")
+
+	url, err := s.URLFor("post.show", 1, "hello-world")
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/1/posts/hello-world", url)
+}
@@ -1,6 +1,10 @@
 package web
 
-import "strings"
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
 
 type tree struct {
 	rootNode *node
@@ -21,6 +25,12 @@ type node struct {
 	params    []string
 	sortOrder int
 	handler   *methodHandler
+
+	constraintExpr string
+	constraint     *regexp.Regexp
+
+	// routes are the registered routes of the node by method
+	routes map[string]*Route
 }
 
 type methodHandler struct {
@@ -65,12 +75,15 @@ const (
 type router struct {
 	webServer *WebServer
 	tree      *tree
+	routes    []*Route
+	names     map[string]*Route
 }
 
 // NewRouter function will create a new router instance
 func newRouter(s *WebServer) *router {
 	return &router{
 		webServer: s,
+		names:     map[string]*Route{},
 		tree: &tree{
 			rootNode: &node{
 				parent:    nil,
@@ -86,16 +99,37 @@ func newRouter(s *WebServer) *router {
 
 // Invoke function is a middleware entry
 func (r *router) Invoke(c *Context, next HandlerFunc) {
-	h := r.Find(c.Request.Method, c.Request.URL.Path, c)
+	method := c.Request.Method
+	n := r.findNode(c.Request.URL.Path, c)
+
+	var h HandlerFunc
+	if n != nil {
+		h = n.findHandler(method)
+	}
 
 	var err error
 
-	if h == nil {
+	switch {
+	case h != nil:
+		c.route = n.routes[method]
+		err = h(c)
+	case n != nil:
+		// the path was matched, but the method was not registered
+		allowed := n.allowedMethods()
+		if n.handler.options == nil {
+			allowed = append(allowed, OPTIONS)
+		}
+		c.Writer.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		if method == OPTIONS {
+			c.SetStatus(http.StatusNoContent)
+		} else if r.webServer.MethodNotAllowedHandler != nil {
+			err = r.webServer.MethodNotAllowedHandler(c)
+		}
+	default:
 		if r.webServer.NotFoundHandler != nil {
 			err = r.webServer.NotFoundHandler(c)
 		}
-	} else {
-		err = h(c)
 	}
 
 	if err != nil && r.webServer.ErrorHandler != nil {
@@ -104,53 +138,54 @@ func (r *router) Invoke(c *Context, next HandlerFunc) {
 }
 
 // All is a shortcut for adding all methods
-func (r *router) All(path string, handler HandlerFunc) {
-	r.Add(GET, path, handler)
-	r.Add(POST, path, handler)
-	r.Add(PUT, path, handler)
-	r.Add(DELETE, path, handler)
-	r.Add(PATCH, path, handler)
-	r.Add(OPTIONS, path, handler)
-	r.Add(HEAD, path, handler)
+func (r *router) All(path string, handler HandlerFunc, mws ...MiddlewareHandler) {
+	r.Add(GET, path, handler, mws...)
+	r.Add(POST, path, handler, mws...)
+	r.Add(PUT, path, handler, mws...)
+	r.Add(DELETE, path, handler, mws...)
+	r.Add(PATCH, path, handler, mws...)
+	r.Add(OPTIONS, path, handler, mws...)
+	r.Add(HEAD, path, handler, mws...)
 }
 
 // Get is a shortcut for router.Add("GET", path, handle)
-func (r *router) Get(path string, handler HandlerFunc) {
-	r.Add(GET, path, handler)
+func (r *router) Get(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return r.Add(GET, path, handler, mws...)
 }
 
 // Post is a shortcut for router.Add("POST", path, handle)
-func (r *router) Post(path string, handler HandlerFunc) {
-	r.Add(POST, path, handler)
+func (r *router) Post(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return r.Add(POST, path, handler, mws...)
 }
 
 // Put is a shortcut for router.Add("PUT", path, handle)
-func (r *router) Put(path string, handler HandlerFunc) {
-	r.Add(PUT, path, handler)
+func (r *router) Put(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return r.Add(PUT, path, handler, mws...)
 }
 
 // Delete is a shortcut for router.Add("DELETE", path, handle)
-func (r *router) Delete(path string, handler HandlerFunc) {
-	r.Add(DELETE, path, handler)
+func (r *router) Delete(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return r.Add(DELETE, path, handler, mws...)
 }
 
 // Patch is a shortcut for router.Add("PATCH", path, handle)
-func (r *router) Patch(path string, handler HandlerFunc) {
-	r.Add(PATCH, path, handler)
+func (r *router) Patch(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return r.Add(PATCH, path, handler, mws...)
 }
 
 // Options is a shortcut for router.Add("OPTIONS", path, handle)
-func (r *router) Options(path string, handler HandlerFunc) {
-	r.Add(OPTIONS, path, handler)
+func (r *router) Options(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return r.Add(OPTIONS, path, handler, mws...)
 }
 
 // Head is a shortcut for router.Add("HEAD", path, handle)
-func (r *router) Head(path string, handler HandlerFunc) {
-	r.Add(HEAD, path, handler)
+func (r *router) Head(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return r.Add(HEAD, path, handler, mws...)
 }
 
-// Add function which adding path and handler to router
-func (r *router) Add(method string, path string, handler HandlerFunc) {
+// Add function which adding path and handler to router.  The route middleware `mws` only wrap the handler and
+// are executed after routing, so path parameters are already available.
+func (r *router) Add(method string, path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
 	_logger.debug("===Add")
 
 	if len(path) == 0 {
@@ -161,16 +196,20 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 		panic("router: path was invalid")
 	}
 
+	route := r.addRoute(method, path, handler)
+
 	if len(path) > 1 {
 		path = path[1:]
 	}
 
 	_logger.debug("path:" + path)
 
+	handler = compose(handler, mws)
+
 	currentNode := r.tree.rootNode
 	if path == "/" {
-		currentNode.addHandler(method, handler)
-		return
+		currentNode.addHandler(method, route, handler)
+		return route
 	}
 
 	pathArray := strings.Split(path, "/")
@@ -188,13 +227,15 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 
 		switch firstSymbol {
 		case ':':
-			// this is parameter node
-			pName := element[1:]
+			// this is parameter node, ex: `:id` or `:id<int>`
+			pName, expr := parseParam(element[1:])
 			_logger.debug("parameter_node_pname:" + pName)
-			childNode = currentNode.findChildByKind(pkind)
+			childNode = currentNode.findParamChild(expr)
 
 			if childNode == nil {
 				childNode = newNode(pName, pkind)
+				childNode.constraintExpr = expr
+				childNode.constraint = compileConstraint(expr)
 				currentNode.addChild(childNode)
 			}
 
@@ -236,123 +277,133 @@ func (r *router) Add(method string, path string, handler HandlerFunc) {
 		// last node in the path
 		if count == index+1 {
 			childNode.params = pathParams
-			childNode.addHandler(method, handler)
+			childNode.addHandler(method, route, handler)
 		}
 
 		currentNode = childNode
 	}
+
+	return route
 }
 
 // Find returns http handler for specific path
 func (r *router) Find(method string, path string, c *Context) HandlerFunc {
 	_logger.debug("===Find")
 	_logger.debug("method:" + method)
-	_logger.debug("path:" + path)
 
-	path = sanitizeUrl(path)
-
-	currentNode := r.tree.rootNode
-	if path == "/" {
-		return currentNode.findHandler(method)
+	n := r.findNode(path, c)
+	if n == nil {
+		return nil
 	}
 
-	pathArray := strings.Split(path, "/")
-	count := len(pathArray)
+	return n.findHandler(method)
+}
 
-	pathParams := make(map[int][]Param)
+// findNode returns the node which matches the path and saves the path parameters to the context.
+// The node may not have any handler for the request method.
+func (r *router) findNode(path string, c *Context) *node {
+	_logger.debug("path:" + path)
 
-	var paramsNum int
+	path = sanitizeUrl(path)
 
-	for index, element := range pathArray {
-		if len(element) == 0 {
-			continue
+	currentNode := r.tree.rootNode
+	if path == "/" {
+		if !currentNode.hasHandler() {
+			return nil
 		}
+		return currentNode
+	}
 
-		// find static node first
-		childNode := currentNode.findChildByName(element)
-
-		if childNode == nil {
-			// looking for parameter node
-			childNode = currentNode.findChildByKind(pkind)
+	// trailing slash is not allowed
+	if strings.HasSuffix(path, "/") {
+		return nil
+	}
 
-			if childNode != nil {
-				_logger.debugf("parameter node: %s", element)
+	pathArray := strings.Split(path, "/")
 
-				var newParams []Param
+	childNode, pathParams := currentNode.match(pathArray, 0, nil)
+	if childNode == nil {
+		_logger.debug("handler was not found")
+		return nil
+	}
 
-				for _, pName := range childNode.pNames {
-					param := Param{Key: pName, Value: element}
-					newParams = append(newParams, param)
-				}
+	_logger.debug("lastNode_params_count:", len(childNode.params))
 
-				pathParams[paramsNum] = newParams
-				paramsNum++
+	for paramsNum, validParam := range childNode.params {
+		for _, p := range pathParams[paramsNum] {
+			if validParam == p.Key {
+				_logger.debug("matched: " + validParam + "," + p.Value)
+				c.params = append(c.params, p)
 			}
 		}
+	}
 
-		if childNode == nil {
-			// looking for match any node
-			childNode = currentNode.findChildByKind(akind)
-
-			if childNode != nil {
-				_logger.debugf("match node: %s", element)
-				start := 0
-
-				for i := 0; i < index; i++ {
-					start += 1 + len(pathArray[i])
-				}
-
-				_logger.debugf("start: %d", start)
-				_logger.debugf("pname count: %d", len(childNode.pNames))
+	return childNode
+}
 
-				var newParams []Param
+// match walks the tree to find the node which matches the path segments.  Static node has the highest priority,
+// parameter nodes with constraint are tried before parameter node without constraint, and match any node
+// is the last one.  If the rest of the path can't be matched, the next candidate node will be tried.
+func (n *node) match(pathArray []string, index int, pathParams [][]Param) (*node, [][]Param) {
+	for index < len(pathArray) && len(pathArray[index]) == 0 {
+		index++
+	}
 
-				for _, pName := range childNode.pNames {
-					val := path[start:]
-					_logger.debugf("val: %s", val)
-					param := Param{Key: pName, Value: val}
-					newParams = append(newParams, param)
-				}
+	if index == len(pathArray) {
+		if !n.hasHandler() {
+			return nil, nil
+		}
+		return n, pathParams
+	}
 
-				pathParams[paramsNum] = newParams
-				paramsNum++
+	element := pathArray[index]
 
-				index = count - 1
-			}
+	// find static node first
+	if childNode := n.findChildByName(element); childNode != nil {
+		if result, params := childNode.match(pathArray, index+1, pathParams); result != nil {
+			return result, params
 		}
+	}
 
-		if childNode == nil {
-			return nil
-		}
+	// looking for parameter node
+	for _, constrained := range []bool{true, false} {
+		for _, childNode := range n.children {
+			if childNode.kind != pkind || (childNode.constraint != nil) != constrained {
+				continue
+			}
 
-		// last node in the path
-		if count == index+1 {
-			myHandler := childNode.findHandler(method)
-			if myHandler == nil {
-				_logger.debug("handler was not found")
-				return nil
+			if childNode.constraint != nil && !childNode.constraint.MatchString(element) {
+				continue
 			}
 
-			paramsNum = 0
-			// println("params_count:", len(pathParams))
-			_logger.debug("lastNode_params_count:", len(childNode.params))
+			_logger.debugf("parameter node: %s", element)
 
-			for _, validParam := range childNode.params {
-				for _, p := range pathParams[paramsNum] {
-					if validParam == p.Key {
-						_logger.debug("matched: " + validParam + "," + p.Value)
-						c.params = append(c.params, p)
-					}
-				}
-				paramsNum++
+			newParams := make([]Param, 0, len(childNode.pNames))
+			for _, pName := range childNode.pNames {
+				newParams = append(newParams, Param{Key: pName, Value: element})
 			}
 
-			return myHandler
+			if result, params := childNode.match(pathArray, index+1, append(pathParams, newParams)); result != nil {
+				return result, params
+			}
 		}
+	}
 
-		currentNode = childNode
+	// looking for match any node
+	childNode := n.findChildByKind(akind)
+	if childNode == nil || !childNode.hasHandler() {
+		return nil, nil
 	}
-	return nil
+
+	val := strings.Join(pathArray[index:], "/")
+	_logger.debugf("match node: %s", val)
+
+	newParams := make([]Param, 0, len(childNode.pNames))
+	for _, pName := range childNode.pNames {
+		newParams = append(newParams, Param{Key: pName, Value: val})
+	}
+
+	return childNode, append(pathParams, newParams)
 }
 
 func newNode(name string, t kind) *node {
@@ -392,7 +443,22 @@ func (n *node) findChildByKind(t kind) *node {
 	return nil
 }
 
-func (n *node) addHandler(method string, h HandlerFunc) {
+func (n *node) findParamChild(expr string) *node {
+	for _, c := range n.children {
+		if c.kind == pkind && c.constraintExpr == expr {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (n *node) addHandler(method string, route *Route, h HandlerFunc) {
+	if n.routes == nil {
+		n.routes = map[string]*Route{}
+	}
+	n.routes[method] = route
+
 	switch method {
 	case GET:
 		n.handler.get = h
@@ -438,10 +504,67 @@ func (n *node) findHandler(method string) HandlerFunc {
 	case TRACE:
 		return n.handler.trace
 	default:
-		panic("method was invalid")
+		return nil
 	}
 }
 
+// allowedMethods returns the methods which have a handler on the node
+func (n *node) allowedMethods() []string {
+	methods := make([]string, 0, 9)
+
+	for _, method := range []string{GET, POST, PUT, DELETE, PATCH, HEAD, OPTIONS, CONNECT, TRACE} {
+		if n.findHandler(method) != nil {
+			methods = append(methods, method)
+		}
+	}
+
+	return methods
+}
+
+func (n *node) hasHandler() bool {
+	return len(n.allowedMethods()) > 0
+}
+
+// constraints are the predefined typed constraints which can be used in path parameters, ex: `/users/:id<int>`
+var constraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// parseParam splits the parameter segment into name and constraint expression, ex: `id<int>` returns `id` and `int`
+func parseParam(element string) (string, string) {
+	start := strings.IndexByte(element, '<')
+	if start < 0 {
+		return element, ""
+	}
+
+	if element[len(element)-1] != '>' || start == 0 {
+		panic("router: parameter '" + element + "' was invalid")
+	}
+
+	return element[:start], element[start+1 : len(element)-1]
+}
+
+func compileConstraint(expr string) *regexp.Regexp {
+	if len(expr) == 0 {
+		return nil
+	}
+
+	if pattern, found := constraints[expr]; found {
+		expr = pattern
+	}
+
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		panic("router: constraint '" + expr + "' was invalid: " + err.Error())
+	}
+
+	return re
+}
+
 func sanitizeUrl(redir string) string {
 	if len(redir) > 1 && redir[0] == '/' && redir[1] != '/' && redir[1] != '\\' {
 		return redir
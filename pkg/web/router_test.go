@@ -1,7 +1,9 @@
 package web
 
 import (
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -99,3 +101,162 @@ func TestRouterMatchAnyRoute(t *testing.T) {
 	assert.Equal(t, "aabbc", helo)
 	assert.Equal(t, 200, w.Code)
 }
+
+func TestRouterRouteMiddleware(t *testing.T) {
+	_, w, s := createTestContext()
+
+	var steps []string
+
+	auth := MiddlewareFunc(func(c *Context, next HandlerFunc) {
+		steps = append(steps, "auth:"+c.Param("id"))
+		_ = next(c)
+	})
+
+	limit := MiddlewareFunc(func(c *Context, next HandlerFunc) {
+		steps = append(steps, "limit")
+		_ = next(c)
+	})
+
+	s.Get("/users/:id", func(c *Context) error {
+		steps = append(steps, "handler")
+		return nil
+	}, auth, limit)
+
+	s.Get("/health", func(c *Context) error {
+		steps = append(steps, "health")
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "/users/123", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, []string{"auth:123", "limit", "handler"}, steps)
+
+	steps = nil
+	req, _ = http.NewRequest("GET", "/health", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, []string{"health"}, steps)
+}
+
+func TestRouterRouteMiddlewareError(t *testing.T) {
+	_, w, s := createTestContext()
+
+	var handledErr error
+	s.ErrorHandler = func(c *Context, err error) {
+		handledErr = err
+	}
+
+	s.Get("/error", func(c *Context) error {
+		return errors.New("oops")
+	}, MiddlewareFunc(func(c *Context, next HandlerFunc) {
+		_ = next(c)
+	}))
+
+	req, _ := http.NewRequest("GET", "/error", nil)
+	s.ServeHTTP(w, req)
+	assert.EqualError(t, handledErr, "oops")
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	_, _, s := createTestContext()
+
+	s.Get("/users/:id", func(c *Context) error {
+		return c.String(200, "ok")
+	})
+	s.Put("/users/:id", func(c *Context) error {
+		return c.String(200, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/users/1", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "GET, PUT, OPTIONS", w.Header().Get("Allow"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PROPFIND", "/users/1", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 405, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "/users/1", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 204, w.Code)
+	assert.Equal(t, "GET, PUT, OPTIONS", w.Header().Get("Allow"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/users", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestRouterParameterConstraint(t *testing.T) {
+	_, _, s := createTestContext()
+
+	var matched, value string
+
+	s.Get("/users/:id<int>", func(c *Context) error {
+		matched, value = "id", c.Param("id")
+		return nil
+	})
+	s.Get("/users/:name", func(c *Context) error {
+		matched, value = "name", c.Param("name")
+		return nil
+	})
+	s.Get("/files/:name<[a-z0-9-]+>", func(c *Context) error {
+		matched, value = "file", c.Param("name")
+		return nil
+	})
+	s.Get("/orders/:id<uint>/items", func(c *Context) error {
+		matched, value = "items", c.Param("id")
+		return nil
+	})
+	s.Get("/orders/:code/detail", func(c *Context) error {
+		matched, value = "detail", c.Param("code")
+		return nil
+	})
+
+	testCases := []struct {
+		path    string
+		code    int
+		matched string
+		value   string
+	}{
+		{"/users/123", 200, "id", "123"},
+		{"/users/-5", 200, "id", "-5"},
+		{"/users/john", 200, "name", "john"},
+		{"/files/my-file-01", 200, "file", "my-file-01"},
+		{"/files/My_File", 404, "", ""},
+		{"/orders/10/items", 200, "items", "10"},
+		{"/orders/10/detail", 200, "detail", "10"},
+		{"/orders/abc/items", 404, "", ""},
+	}
+
+	for _, tc := range testCases {
+		matched, value = "", ""
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		s.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.path)
+		assert.Equal(t, tc.matched, matched, tc.path)
+		assert.Equal(t, tc.value, value, tc.path)
+	}
+}
+
+func TestRouterInvalidConstraint(t *testing.T) {
+	_, _, s := createTestContext()
+
+	assert.Panics(t, func() {
+		s.Get("/users/:id<[0-9>", func(c *Context) error { return nil })
+	})
+
+	assert.Panics(t, func() {
+		s.Get("/users/:id<int", func(c *Context) error { return nil })
+	})
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+// SessionKey is the key of the session which is saved in the context by the session middleware
+const SessionKey = "session"
+
+const flashesKey = "_flashes"
+
+// Session is the state of a client which is kept between requests.  The values are encoded as json, so the numbers
+// are float64 after they are loaded.
+type Session struct {
+	ID         string                 `json:"id"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	AccessedAt time.Time              `json:"accessed_at"`
+	modified   bool
+	destroyed  bool
+	previousID string
+}
+
+// NewSession returns a new session with a random id
+func NewSession() *Session {
+	now := time.Now()
+
+	return &Session{
+		ID:         newSessionID(),
+		Values:     map[string]interface{}{},
+		CreatedAt:  now,
+		AccessedAt: now,
+	}
+}
+
+// Session returns the session of the request.  It panics if the session middleware is not used.
+func (c *Context) Session() *Session {
+	session, _ := c.MustGet(SessionKey).(*Session)
+	return session
+}
+
+// Get returns the value of the key
+func (s *Session) Get(key string) (interface{}, bool) {
+	value, found := s.Values[key]
+	return value, found
+}
+
+// GetString returns the value of the key as string.  It returns empty string if the value is not a string.
+func (s *Session) GetString(key string) string {
+	value, _ := s.Values[key].(string)
+	return value
+}
+
+// Set saves the value of the key
+func (s *Session) Set(key string, value interface{}) {
+	if s.Values == nil {
+		s.Values = map[string]interface{}{}
+	}
+
+	s.Values[key] = value
+	s.modified = true
+}
+
+// Delete removes the value of the key
+func (s *Session) Delete(key string) {
+	if _, found := s.Values[key]; found {
+		delete(s.Values, key)
+		s.modified = true
+	}
+}
+
+// Clear removes all values
+func (s *Session) Clear() {
+	if len(s.Values) > 0 {
+		s.Values = map[string]interface{}{}
+		s.modified = true
+	}
+}
+
+// AddFlash adds a message which is removed after it is read by `Flashes`
+func (s *Session) AddFlash(value interface{}) {
+	flashes, _ := s.Values[flashesKey].([]interface{})
+	s.Set(flashesKey, append(flashes, value))
+}
+
+// Flashes returns and removes the flash messages
+func (s *Session) Flashes() []interface{} {
+	flashes, _ := s.Values[flashesKey].([]interface{})
+	s.Delete(flashesKey)
+	return flashes
+}
+
+// Regenerate changes the session id and keeps the values.  It should be called after the user signs in to prevent
+// session fixation.
+func (s *Session) Regenerate() {
+	if len(s.previousID) == 0 {
+		s.previousID = s.ID
+	}
+
+	s.ID = newSessionID()
+	s.modified = true
+}
+
+// Destroy removes the session and its cookie at the end of the request
+func (s *Session) Destroy() {
+	s.Values = map[string]interface{}{}
+	s.destroyed = true
+	s.modified = true
+}
+
+// IsModified returns true if the session was changed during the request
+func (s *Session) IsModified() bool {
+	return s.modified
+}
+
+// IsDestroyed returns true if `Destroy` was called
+func (s *Session) IsDestroyed() bool {
+	return s.destroyed
+}
+
+// PreviousID returns the session id before `Regenerate` was called
+func (s *Session) PreviousID() string {
+	return s.previousID
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
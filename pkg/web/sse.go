@@ -0,0 +1,174 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSSEHeartbeat = 15 * time.Second
+)
+
+// SSEvent is an event of server-sent events
+type SSEvent struct {
+	// ID is saved by the client and sent back with the `Last-Event-ID` header when the client reconnects
+	ID string
+	// Event is the event type.  The client dispatches a "message" event if it is empty.
+	Event string
+	// Data is the payload of the event.  Multiple lines are sent as multiple data fields.
+	Data string
+	// Retry is the reconnection time of the client
+	Retry time.Duration
+}
+
+// SSEWriter writes server-sent events to the client.  It is safe to be called concurrently, but it must not be
+// used after the handler returns.
+type SSEWriter struct {
+	mu        sync.Mutex
+	c         *Context
+	heartbeat time.Duration
+}
+
+// SSE starts a server-sent events stream.  The headers are sent to the client immediately.
+func (c *Context) SSE() (*SSEWriter, error) {
+	if err := c.Request.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	headers := c.Writer.Header()
+	headers.Set("Content-Type", "text/event-stream")
+	headers.Set("Cache-Control", "no-cache")
+	headers.Set("Connection", "keep-alive")
+	// disable the response buffering of nginx
+	headers.Set("X-Accel-Buffering", "no")
+	headers.Del("Content-Length")
+
+	// the stream is long-lived, so the write timeout of the server is removed
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Writer.WriteHeader(200)
+	c.Writer.Flush()
+
+	return &SSEWriter{
+		c:         c,
+		heartbeat: defaultSSEHeartbeat,
+	}, nil
+}
+
+// LastEventID returns the id of the last event which the client received before reconnecting
+func (w *SSEWriter) LastEventID() string {
+	return w.c.RequestHeader("Last-Event-ID")
+}
+
+// Done returns a channel which is closed when the client disconnects
+func (w *SSEWriter) Done() <-chan struct{} {
+	return w.c.Request.Context().Done()
+}
+
+// SetHeartbeat sets the interval of heartbeat comments which are sent by `Stream`, so the proxies don't close the
+// idle connection.  Default value is 15 seconds and zero disables the heartbeat.
+func (w *SSEWriter) SetHeartbeat(interval time.Duration) {
+	w.heartbeat = interval
+}
+
+// Send writes the event and flushes it to the client
+func (w *SSEWriter) Send(event SSEvent) error {
+	var buf bytes.Buffer
+
+	if len(event.ID) > 0 {
+		buf.WriteString("id: " + sanitizeSSEField(event.ID) + "\n")
+	}
+
+	if len(event.Event) > 0 {
+		buf.WriteString("event: " + sanitizeSSEField(event.Event) + "\n")
+	}
+
+	if event.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	// the event which only contains retry field doesn't need data
+	if len(event.Data) > 0 || len(event.ID) > 0 || len(event.Event) > 0 {
+		data := strings.ReplaceAll(event.Data, "\r\n", "\n")
+		data = strings.ReplaceAll(data, "\r", "\n")
+
+		for _, line := range strings.Split(data, "\n") {
+			buf.WriteString("data: " + line + "\n")
+		}
+	}
+
+	buf.WriteString("\n")
+
+	return w.write(buf.Bytes())
+}
+
+// Comment writes a comment which is ignored by the client
+func (w *SSEWriter) Comment(text string) error {
+	return w.write([]byte(": " + sanitizeSSEField(text) + "\n\n"))
+}
+
+func (w *SSEWriter) write(b []byte) error {
+	if err := w.c.Request.Context().Err(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.c.Writer.Write(b); err != nil {
+		return err
+	}
+
+	w.c.Writer.Flush()
+	return nil
+}
+
+// Stream sends the events from the channel and heartbeat comments until the channel is closed or the client
+// disconnects.  It returns nil in both cases.
+func (w *SSEWriter) Stream(events <-chan SSEvent) error {
+	var heartbeat <-chan time.Time
+
+	if w.heartbeat > 0 {
+		ticker := time.NewTicker(w.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-w.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if err := w.Send(event); err != nil {
+				return w.ignoreCanceled(err)
+			}
+		case <-heartbeat:
+			if err := w.Comment("heartbeat"); err != nil {
+				return w.ignoreCanceled(err)
+			}
+		}
+	}
+}
+
+func (w *SSEWriter) ignoreCanceled(err error) error {
+	if w.c.Request.Context().Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// sanitizeSSEField removes line breaks, because they end the field
+func sanitizeSSEField(s string) string {
+	if !strings.ContainsAny(s, "\r\n") {
+		return s
+	}
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
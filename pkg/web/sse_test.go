@@ -0,0 +1,86 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSESend(t *testing.T) {
+	s := NewServer()
+	s.Get("/events", func(c *Context) error {
+		sse, err := c.SSE()
+		if err != nil {
+			return err
+		}
+
+		_ = sse.Send(SSEvent{Retry: 3 * time.Second})
+		_ = sse.Send(SSEvent{ID: sse.LastEventID() + "1", Event: "update", Data: "line1\nline2"})
+		_ = sse.Send(SSEvent{ID: "bad\nid", Data: "hello"})
+		return sse.Comment("bye")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events", nil)
+	req.Header.Set("Last-Event-ID", "4")
+	s.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "retry: 3000\n\nid: 41\nevent: update\ndata: line1\ndata: line2\n\nid: badid\ndata: hello\n\n: bye\n\n", w.Body.String())
+}
+
+func TestSSEStream(t *testing.T) {
+	events := make(chan SSEvent)
+	done := make(chan error, 1)
+
+	s := NewServer()
+	s.Get("/events", func(c *Context) error {
+		sse, err := c.SSE()
+		if err != nil {
+			return err
+		}
+
+		sse.SetHeartbeat(10 * time.Millisecond)
+		err = sse.Stream(events)
+		done <- err
+		return err
+	})
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	events <- SSEvent{Data: "hello"}
+
+	buf := make([]byte, 64)
+	n, err := resp.Body.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "data: hello\n\n", string(buf[:n]))
+
+	n, err = resp.Body.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, ": heartbeat\n\n", string(buf[:n]))
+
+	// the stream stops when the client disconnects
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the stream didn't stop")
+	}
+}
@@ -0,0 +1,266 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nite-coder/blackbear/pkg/log"
+)
+
+const (
+	// reloadDelay merges the events which are fired when a certificate is rotated
+	reloadDelay = 200 * time.Millisecond
+)
+
+var (
+	// ErrCertificateNotFound is returned when the TLS options don't contain any certificate
+	ErrCertificateNotFound = errors.New("web: certificate was not found")
+)
+
+// certStore keeps the certificates which are loaded from files and reloads them when the files change
+type certStore struct {
+	mu          sync.RWMutex
+	defaultCert *tls.Certificate
+	certs       map[string]*tls.Certificate
+	clientCAs   *x509.CertPool
+
+	certFile     string
+	keyFile      string
+	domains      []string
+	certPath     string
+	clientCAFile string
+}
+
+func newCertStore(options ServerOptions) (*certStore, error) {
+	store := &certStore{
+		certFile:     options.TLSCertFile,
+		keyFile:      options.TLSKeyFile,
+		domains:      parseDomains(options.Domain),
+		certPath:     options.CertCachePath,
+		clientCAFile: options.ClientCAFile,
+	}
+
+	if len(store.domains) > 0 && len(store.certPath) == 0 {
+		return nil, errors.New("web: CertCachePath can't be empty when Domain is set")
+	}
+
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func parseDomains(domain string) []string {
+	var domains []string
+
+	for _, d := range strings.Split(domain, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if len(d) > 0 {
+			domains = append(domains, d)
+		}
+	}
+
+	return domains
+}
+
+// domainFiles returns the certificate and key file paths of the domain
+func (store *certStore) domainFiles(domain string) (string, string) {
+	return filepath.Join(store.certPath, domain+".crt"), filepath.Join(store.certPath, domain+".key")
+}
+
+// reload loads all certificates.  The current certificates are kept if any of them can't be loaded.
+func (store *certStore) reload() error {
+	var defaultCert *tls.Certificate
+
+	if len(store.certFile) > 0 || len(store.keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(store.certFile, store.keyFile)
+		if err != nil {
+			return fmt.Errorf("web: load certificate failed: %w", err)
+		}
+		defaultCert = &cert
+	}
+
+	certs := make(map[string]*tls.Certificate, len(store.domains))
+
+	for _, domain := range store.domains {
+		certFile, keyFile := store.domainFiles(domain)
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("web: load certificate of '%s' failed: %w", domain, err)
+		}
+		certs[domain] = &cert
+
+		if defaultCert == nil {
+			defaultCert = &cert
+		}
+	}
+
+	if defaultCert == nil {
+		return ErrCertificateNotFound
+	}
+
+	var clientCAs *x509.CertPool
+
+	if len(store.clientCAFile) > 0 {
+		b, err := os.ReadFile(store.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("web: load client ca failed: %w", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(b) {
+			return errors.New("web: client ca doesn't contain any certificate")
+		}
+	}
+
+	store.mu.Lock()
+	store.defaultCert = defaultCert
+	store.certs = certs
+	store.clientCAs = clientCAs
+	store.mu.Unlock()
+
+	return nil
+}
+
+// getCertificate chooses the certificate by SNI.  The exact domain is matched first, then the wildcard domain and
+// the default certificate is returned if none of them is found.
+func (store *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	if cert, found := store.certs[name]; found {
+		return cert, nil
+	}
+
+	if idx := strings.IndexByte(name, '.'); idx > 0 {
+		if cert, found := store.certs["*"+name[idx:]]; found {
+			return cert, nil
+		}
+	}
+
+	return store.defaultCert, nil
+}
+
+func (store *certStore) tlsConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: store.getCertificate,
+		// the config of GetConfigForClient is cloned from this one, so ALPN is set here instead of http.Server
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if len(store.clientCAFile) == 0 {
+		return config
+	}
+
+	if clientAuth == tls.NoClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	// the client ca is reloaded as well, so the config is created for every handshake
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		store.mu.RLock()
+		clientCAs := store.clientCAs
+		store.mu.RUnlock()
+
+		cfg := config.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientAuth = clientAuth
+		cfg.ClientCAs = clientCAs
+
+		return cfg, nil
+	}
+
+	return config
+}
+
+// files returns all files which are watched
+func (store *certStore) files() []string {
+	var files []string
+
+	for _, file := range []string{store.certFile, store.keyFile, store.clientCAFile} {
+		if len(file) > 0 {
+			files = append(files, file)
+		}
+	}
+
+	for _, domain := range store.domains {
+		certFile, keyFile := store.domainFiles(domain)
+		files = append(files, certFile, keyFile)
+	}
+
+	return files
+}
+
+// watch reloads the certificates when the files change until the context is done.  The directories are watched
+// instead of the files, because the files are usually replaced by rename or symlink swap when they are rotated.
+func (store *certStore) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := map[string]bool{}
+	for _, file := range store.files() {
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var timer <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+					timer = time.After(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("web: certificate watcher failed")
+			case <-timer:
+				timer = nil
+
+				if err := store.reload(); err != nil {
+					log.Error().Err(err).Msg("web: reload certificate failed")
+					continue
+				}
+
+				log.Info().Msg("web: certificate reloaded")
+			}
+		}
+	}()
+
+	return nil
+}
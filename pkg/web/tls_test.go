@@ -0,0 +1,201 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (tc *testCert) write(t *testing.T, certFile string, keyFile string) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.cert.Raw})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0600))
+
+	if len(keyFile) > 0 {
+		b, err := x509.MarshalECPrivateKey(tc.key)
+		require.NoError(t, err)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+		require.NoError(t, os.WriteFile(keyFile, keyPEM, 0600))
+	}
+}
+
+func leafCN(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertStoreSNI(t *testing.T) {
+	dir := t.TempDir()
+
+	newTestCert(t, "default.local", nil, false).write(t, filepath.Join(dir, "default.crt"), filepath.Join(dir, "default.key"))
+	newTestCert(t, "abc.com", nil, false).write(t, filepath.Join(dir, "abc.com.crt"), filepath.Join(dir, "abc.com.key"))
+	newTestCert(t, "*.xyz.com", nil, false).write(t, filepath.Join(dir, "*.xyz.com.crt"), filepath.Join(dir, "*.xyz.com.key"))
+
+	store, err := newCertStore(ServerOptions{
+		Domain:        "abc.com, *.xyz.com",
+		CertCachePath: dir,
+		TLSCertFile:   filepath.Join(dir, "default.crt"),
+		TLSKeyFile:    filepath.Join(dir, "default.key"),
+	})
+	require.NoError(t, err)
+
+	cert, _ := store.getCertificate(&tls.ClientHelloInfo{ServerName: "ABC.com"})
+	assert.Equal(t, "abc.com", leafCN(t, cert))
+
+	cert, _ = store.getCertificate(&tls.ClientHelloInfo{ServerName: "api.xyz.com"})
+	assert.Equal(t, "*.xyz.com", leafCN(t, cert))
+
+	cert, _ = store.getCertificate(&tls.ClientHelloInfo{ServerName: "other.com"})
+	assert.Equal(t, "default.local", leafCN(t, cert))
+
+	_, err = newCertStore(ServerOptions{Domain: "abc.com"})
+	assert.Error(t, err)
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	newTestCert(t, "v1.local", nil, false).write(t, certFile, keyFile)
+
+	store, err := newCertStore(ServerOptions{TLSCertFile: certFile, TLSKeyFile: keyFile})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, store.watch(ctx))
+
+	// the current certificate is kept if the new one is invalid
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0600))
+	time.Sleep(2 * reloadDelay)
+	cert, _ := store.getCertificate(&tls.ClientHelloInfo{})
+	assert.Equal(t, "v1.local", leafCN(t, cert))
+
+	newTestCert(t, "v2.local", nil, false).write(t, certFile, keyFile)
+
+	assert.Eventually(t, func() bool {
+		cert, _ := store.getCertificate(&tls.ClientHelloInfo{})
+		return leafCN(t, cert) == "v2.local"
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestRunContextMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, "ca", nil, true)
+	ca.write(t, filepath.Join(dir, "ca.crt"), "")
+	newTestCert(t, "localhost", ca, false).write(t, filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	client := newTestCert(t, "client1", ca, false)
+
+	s := NewServer()
+	s.Get("/", func(c *Context) error {
+		return c.String(200, c.PeerCertificate().Subject.CommonName)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.RunContext(ctx, ServerOptions{
+			Listener:     ln,
+			TLSCertFile:  filepath.Join(dir, "server.crt"),
+			TLSKeyFile:   filepath.Join(dir, "server.key"),
+			ClientCAFile: filepath.Join(dir, "ca.crt"),
+		})
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	newClient := func(certs []tls.Certificate) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				ForceAttemptHTTP2: true,
+				TLSClientConfig: &tls.Config{
+					RootCAs:      roots,
+					ServerName:   "localhost",
+					Certificates: certs,
+					MinVersion:   tls.VersionTLS12,
+				},
+			},
+		}
+	}
+
+	url := "https://" + ln.Addr().String() + "/"
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = newClient([]tls.Certificate{{Certificate: [][]byte{client.cert.Raw}, PrivateKey: client.key}}).Get(url)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "client1", string(b))
+	// h2 is negotiated by ALPN
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "h2", resp.TLS.NegotiatedProtocol)
+
+	// the client certificate is required
+	_, err = newClient(nil).Get(url)
+	assert.Error(t, err)
+
+	cancel()
+	assert.NoError(t, <-runErr)
+}
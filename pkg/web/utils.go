@@ -1,5 +1,11 @@
 package web
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
 func filterFlags(content string) string {
 	for i, char := range content {
 		if char == ' ' || char == ';' {
@@ -8,3 +14,65 @@ func filterFlags(content string) string {
 	}
 	return content
 }
+
+// parseAccept returns the media ranges of the Accept header which are sorted by quality value in descending order
+func parseAccept(accept string) []string {
+	type mediaRange struct {
+		value   string
+		quality float64
+	}
+
+	ranges := make([]mediaRange, 0, 4)
+
+	for _, part := range strings.Split(accept, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		if len(value) == 0 {
+			continue
+		}
+
+		quality := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			key, val, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(key) != "q" {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				quality = q
+			}
+		}
+
+		if quality <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, mediaRange{value: value, quality: quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	result := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		result = append(result, r.value)
+	}
+
+	return result
+}
+
+// matchMediaType reports whether the offered media type matches the accepted media range, ex: `text/*`
+func matchMediaType(accepted string, offered string) bool {
+	if accepted == "*/*" || accepted == "*" || accepted == offered {
+		return true
+	}
+
+	if strings.HasSuffix(accepted, "/*") {
+		return strings.HasPrefix(offered, accepted[:len(accepted)-1])
+	}
+
+	return false
+}
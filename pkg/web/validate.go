@@ -0,0 +1,327 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidRule is returned when the `validate` tag is malformed, ex: `min=abc` or an invalid regex
+	ErrInvalidRule = errors.New("web: validation rule was invalid")
+
+	timeType = reflect.TypeOf(time.Time{})
+
+	// rulesCache saves the parsed rules by the tag, so the tag is only parsed once
+	rulesCache sync.Map
+)
+
+// validationRules are the parsed rules of a `validate` tag
+type validationRules struct {
+	params map[string]string
+	// limits are the parsed params of min and max rules
+	limits map[string]float64
+	regex  *regexp.Regexp
+}
+
+type cachedRules struct {
+	rules *validationRules
+	err   error
+}
+
+// FieldError describes why a field is invalid
+type FieldError struct {
+	// Field is the name of the field.  The name of json, query, form, param or header tag is used if it exists.
+	Field string `json:"field"`
+	// Rule is the validation rule which failed, ex: required, min, max, oneof, regex or type
+	Rule string `json:"rule"`
+	// Param is the parameter of the validation rule, ex: `10` for `min=10`
+	Param string `json:"param,omitempty"`
+	// Value is the invalid value
+	Value interface{} `json:"value,omitempty"`
+	// Message is a human readable error message
+	Message string `json:"message"`
+}
+
+// Error returns the message of the field error
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors is a list of field errors
+type ValidationErrors []FieldError
+
+// Error returns all messages of the field errors
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate validates the struct by the `validate` tags.  Multiple rules are separated by comma, ex:
+//
+//	type CreateUserRequest struct {
+//		Name   string `json:"name" validate:"required,min=2,max=20"`
+//		Role   string `json:"role" validate:"oneof=admin member"`
+//		Handle string `json:"handle" validate:"regex=^[a-z0-9_]+$"`
+//	}
+//
+// Supported rules are required, min, max, oneof and regex.  The `regex` rule must be the last rule because the
+// pattern may contain comma.  Other rules are skipped if the field is zero value and not required, so an
+// explicit zero, ex: `page=0`, passes `min=1`.  Use `required` to reject zero values, or use a pointer field, ex:
+// `Page *int`, to validate the zero value when the field is present.
+// The error will be `ValidationErrors` if any field is invalid or `ErrInvalidRule` if the tag is malformed.
+func Validate(obj interface{}) error {
+	val := reflect.ValueOf(obj)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+
+	errs, err := validateStruct(val, "")
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateStruct(val reflect.Value, prefix string) (ValidationErrors, error) {
+	var errs ValidationErrors
+
+	typ := val.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldVal := val.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := prefix + fieldName(field)
+
+		if tag := field.Tag.Get("validate"); len(tag) > 0 && tag != "-" {
+			fieldErrs, err := validateField(fieldVal, name, tag)
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, fieldErrs...)
+		}
+
+		// validate nested struct
+		nested := fieldVal
+		if nested.Kind() == reflect.Ptr {
+			if nested.IsNil() {
+				continue
+			}
+			nested = nested.Elem()
+		}
+
+		if nested.Kind() == reflect.Struct && nested.Type() != timeType {
+			nestedPrefix := name + "."
+			if field.Anonymous {
+				nestedPrefix = prefix
+			}
+
+			nestedErrs, err := validateStruct(nested, nestedPrefix)
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, nestedErrs...)
+		}
+	}
+
+	return errs, nil
+}
+
+func validateField(val reflect.Value, name string, tag string) (ValidationErrors, error) {
+	var errs ValidationErrors
+
+	rules, err := getRules(tag)
+	if err != nil {
+		return nil, fmt.Errorf("%w of field '%s'", err, name)
+	}
+
+	if val.IsZero() {
+		if _, required := rules.params["required"]; required {
+			return append(errs, FieldError{
+				Field:   name,
+				Rule:    "required",
+				Message: name + " is required",
+			}), nil
+		}
+		return nil, nil
+	}
+
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	for _, rule := range []string{"min", "max", "oneof", "regex"} {
+		if _, found := rules.params[rule]; !found {
+			continue
+		}
+
+		if fieldErr := validateRule(val, name, rule, rules); fieldErr != nil {
+			errs = append(errs, *fieldErr)
+		}
+	}
+
+	return errs, nil
+}
+
+func validateRule(val reflect.Value, name string, rule string, rules *validationRules) *FieldError {
+	param := rules.params[rule]
+
+	fieldErr := &FieldError{
+		Field: name,
+		Rule:  rule,
+		Param: param,
+		Value: val.Interface(),
+	}
+
+	switch rule {
+	case "min", "max":
+		limit := rules.limits[rule]
+		size, isLength := sizeOf(val)
+
+		if (rule == "min" && size >= limit) || (rule == "max" && size <= limit) {
+			return nil
+		}
+
+		switch {
+		case isLength && rule == "min":
+			fieldErr.Message = fmt.Sprintf("%s must be at least %s in length", name, param)
+		case isLength:
+			fieldErr.Message = fmt.Sprintf("%s must be at most %s in length", name, param)
+		case rule == "min":
+			fieldErr.Message = fmt.Sprintf("%s must be %s or greater", name, param)
+		default:
+			fieldErr.Message = fmt.Sprintf("%s must be %s or less", name, param)
+		}
+	case "oneof":
+		s := fmt.Sprint(val.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return nil
+			}
+		}
+
+		fieldErr.Message = fmt.Sprintf("%s must be one of [%s]", name, param)
+	case "regex":
+		if rules.regex.MatchString(fmt.Sprint(val.Interface())) {
+			return nil
+		}
+
+		fieldErr.Message = fmt.Sprintf("%s has an invalid format", name)
+	}
+
+	return fieldErr
+}
+
+// sizeOf returns the length of string, slice and map, otherwise the number value is returned
+func sizeOf(val reflect.Value) (float64, bool) {
+	switch val.Kind() { //nolint:exhaustive
+	case reflect.String:
+		return float64(len([]rune(val.String()))), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(val.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), false
+	default:
+		return 0, false
+	}
+}
+
+// getRules returns the parsed rules of the tag from the cache
+func getRules(tag string) (*validationRules, error) {
+	if cached, found := rulesCache.Load(tag); found {
+		entry := cached.(cachedRules)
+		return entry.rules, entry.err
+	}
+
+	rules, err := parseRules(tag)
+	rulesCache.Store(tag, cachedRules{rules: rules, err: err})
+
+	return rules, err
+}
+
+func parseRules(tag string) (*validationRules, error) {
+	rules := &validationRules{
+		params: map[string]string{},
+		limits: map[string]float64{},
+	}
+
+	for len(tag) > 0 {
+		var rule string
+
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			rule, tag = tag[:idx], tag[idx+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		rule = strings.TrimSpace(rule)
+		if len(rule) == 0 {
+			continue
+		}
+
+		key, param, _ := strings.Cut(rule, "=")
+		rules.params[key] = param
+
+		switch key {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: '%s' must be a number", ErrInvalidRule, rule)
+			}
+			rules.limits[key] = limit
+		case "regex":
+			re, err := regexp.Compile(param)
+			if err != nil {
+				return nil, fmt.Errorf("%w: '%s': %w", ErrInvalidRule, rule, err)
+			}
+			rules.regex = re
+		}
+	}
+
+	return rules, nil
+}
+
+// fieldName returns the name which is used in the request, so the client is able to know which field is invalid
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "xml", "query", "form", "param", "header"} {
+		tag := field.Tag.Get(key)
+		name, _, _ := strings.Cut(tag, ",")
+
+		if len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
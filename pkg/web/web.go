@@ -2,10 +2,17 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"html/template"
+	"net"
 	"net/http"
-	"path"
+	"net/netip"
+	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -55,17 +62,29 @@ func WrapHandler(h http.Handler) HandlerFunc {
 
 // WebServer is root level of framework instance
 type WebServer struct {
-	server           *http.Server
-	pool             sync.Pool
-	handlers         []MiddlewareHandler
-	middleware       middleware
-	template         *template.Template
-	templateRootPath string
-	router           *router
-
-	MaxRequestBodySize int64
-	ErrorHandler       ErrorHandler
-	NotFoundHandler    HandlerFunc
+	mu            sync.Mutex
+	server        *http.Server
+	shutdownHooks []func()
+	draining      atomic.Bool
+	pool          sync.Pool
+	handlers      []MiddlewareHandler
+	middleware    middleware
+	router        *router
+
+	trustedProxiesOnce sync.Once
+	trustedPrefixes    []netip.Prefix
+
+	// TrustedProxies are the ips or cidrs of the reverse proxies, ex: "10.0.0.0/8".  The forwarded headers are
+	// only used by `Context.ClientIP`, `Scheme` and `Host` if the request was sent by them.  It must be set before
+	// the server starts.
+	TrustedProxies []string
+	// Renderer renders the views of `Context.Render`.  It is set by `SetRender`, `SetTemplate` or a custom
+	// template engine.
+	Renderer                Renderer
+	MaxRequestBodySize      int64
+	ErrorHandler            ErrorHandler
+	NotFoundHandler         HandlerFunc
+	MethodNotAllowedHandler HandlerFunc
 }
 
 // NewServer returns a new WebServer instance
@@ -84,11 +103,19 @@ func NewServer(mHandlers ...MiddlewareHandler) *WebServer {
 	s.router = newRouter(s)
 	s.Use(s.router)
 
+	s.ErrorHandler = DefaultErrorHandler
+
 	s.NotFoundHandler = func(c *Context) error {
 		c.SetStatus(404)
 		return nil
 	}
 
+	// the `Allow` header has been set by router before the handler is invoked
+	s.MethodNotAllowedHandler = func(c *Context) error {
+		c.SetStatus(405)
+		return nil
+	}
+
 	return s
 }
 
@@ -110,86 +137,120 @@ func (s *WebServer) Use(mHandler MiddlewareHandler) {
 }
 
 // All is a shortcut for adding all methods
-func (s *WebServer) All(path string, handler HandlerFunc) {
-	s.router.Add(GET, path, handler)
-	s.router.Add(POST, path, handler)
-	s.router.Add(PUT, path, handler)
-	s.router.Add(DELETE, path, handler)
-	s.router.Add(PATCH, path, handler)
-	s.router.Add(OPTIONS, path, handler)
-	s.router.Add(HEAD, path, handler)
+func (s *WebServer) All(path string, handler HandlerFunc, mws ...MiddlewareHandler) {
+	s.router.Add(GET, path, handler, mws...)
+	s.router.Add(POST, path, handler, mws...)
+	s.router.Add(PUT, path, handler, mws...)
+	s.router.Add(DELETE, path, handler, mws...)
+	s.router.Add(PATCH, path, handler, mws...)
+	s.router.Add(OPTIONS, path, handler, mws...)
+	s.router.Add(HEAD, path, handler, mws...)
 }
 
 // Get is a shortcut for router.Add("GET", path, handle)
-func (s *WebServer) Get(path string, handler HandlerFunc) {
-	s.router.Add(GET, path, handler)
+func (s *WebServer) Get(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(GET, path, handler, mws...)
 }
 
 // Post is a shortcut for router.Add("POST", path, handle)
-func (s *WebServer) Post(path string, handler HandlerFunc) {
-	s.router.Add(POST, path, handler)
+func (s *WebServer) Post(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(POST, path, handler, mws...)
 }
 
 // Put is a shortcut for router.Add("PUT", path, handle)
-func (s *WebServer) Put(path string, handler HandlerFunc) {
-	s.router.Add(PUT, path, handler)
+func (s *WebServer) Put(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(PUT, path, handler, mws...)
 }
 
 // Delete is a shortcut for router.Add("DELETE", path, handle)
-func (s *WebServer) Delete(path string, handler HandlerFunc) {
-	s.router.Add(DELETE, path, handler)
+func (s *WebServer) Delete(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(DELETE, path, handler, mws...)
 }
 
 // Patch is a shortcut for router.Add("PATCH", path, handle)
-func (s *WebServer) Patch(path string, handler HandlerFunc) {
-	s.router.Add(PATCH, path, handler)
+func (s *WebServer) Patch(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(PATCH, path, handler, mws...)
 }
 
 // Options is a shortcut for router.Add("OPTIONS", path, handle)
-func (s *WebServer) Options(path string, handler HandlerFunc) {
-	s.router.Add(OPTIONS, path, handler)
+func (s *WebServer) Options(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(OPTIONS, path, handler, mws...)
 }
 
 // Head is a shortcut for router.Add("HEAD", path, handle)
-func (s *WebServer) Head(path string, handler HandlerFunc) {
-	s.router.Add(HEAD, path, handler)
+func (s *WebServer) Head(path string, handler HandlerFunc, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(HEAD, path, handler, mws...)
 }
 
-// SetTemplate function allows user to set their own template instance.
+// SetTemplate function allows user to set their own template instance.  The view name of `Context.Render` is
+// the name of the template.
 func (s *WebServer) SetTemplate(t *template.Template) {
-	s.template = t
+	s.Renderer = &templateRenderer{tmpl: t}
 }
 
-// SetRender function allows user to set template location.
+// SetRender function allows user to set template location.  The templates are parsed by HTMLRenderer once and it
+// panics if the templates can't be parsed.  Use `NewHTMLRenderer` to load the templates from embed.FS, set the
+// layout or the functions.
 func (s *WebServer) SetRender(templateRootPath string) {
-	sharedTemplatePath := path.Join(templateRootPath, "shares/*")
-	tmpl, err := template.ParseGlob(sharedTemplatePath)
-	template := template.Must(tmpl, err)
-
-	if template == nil {
-		_logger.debug("no template")
-		template = template.New("")
+	renderer, err := NewHTMLRenderer(HTMLRendererOptions{Dir: templateRootPath})
+	if err != nil {
+		panic(err)
 	}
 
-	s.template = template
-	s.templateRootPath = templateRootPath
+	s.Renderer = renderer
 }
 
 // Run will start to run a http server
 // TODO: allow multiple ports and addrs
 func (s *WebServer) Run(addr string) error {
-	serv := new(http.Server)
-	serv.Addr = addr
-	serv.Handler = s
-	s.server = serv
+	serv := s.newServer(ServerOptions{Addr: addr})
 	return serv.ListenAndServe()
 }
 
+// Shutdown gracefully shuts down the server.  The readiness of health middleware is flipped to failing, in-flight
+// requests are drained until the context is done and the OnShutdown hooks are run at the end.
 func (s *WebServer) Shutdown(ctx context.Context) error {
-	if s.server == nil {
+	s.mu.Lock()
+	serv := s.server
+	s.mu.Unlock()
+
+	if serv == nil {
 		return nil
 	}
-	return s.server.Shutdown(ctx)
+
+	s.draining.Store(true)
+	err := serv.Shutdown(ctx)
+	if err != nil {
+		// the deadline was exceeded, so the remaining connections are closed
+		_ = serv.Close()
+	}
+
+	s.runShutdownHooks()
+
+	return err
+}
+
+// OnShutdown registers a function which is called after the in-flight requests are drained, ex: log.Flush
+func (s *WebServer) OnShutdown(hook func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+func (s *WebServer) runShutdownHooks() {
+	s.mu.Lock()
+	hooks := s.shutdownHooks
+	s.shutdownHooks = nil
+	s.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// IsReady returns false once the server starts shutting down
+func (s *WebServer) IsReady() bool {
+	return !s.draining.Load()
 }
 
 // RunAll will listen on multiple port
@@ -215,31 +276,183 @@ func (s *WebServer) Shutdown(ctx context.Context) error {
 // 	return nil
 // }
 
+// ServerOptions is a configuration container to setup the http server.
 type ServerOptions struct {
-	Addr          string
-	Domain        string // abc123.com, abc456.com
+	Addr string
+	// Domain is a comma separated list of domains, ex: abc123.com, *.abc456.com.  The certificate of each domain
+	// is loaded from "<CertCachePath>/<domain>.crt" and "<CertCachePath>/<domain>.key" and chosen by SNI.
+	Domain        string
 	CertCachePath string
-	TLSCertFile   string
-	TLSKeyFile    string
-	ReadTimeout   time.Duration
-	WriteTimeout  time.Duration
+	// TLSCertFile and TLSKeyFile are the default certificate which is used when SNI doesn't match any domain.
+	// The certificates are reloaded when the files change.
+	TLSCertFile  string
+	TLSKeyFile   string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// ClientCAFile enables mutual TLS.  The client certificates are verified by the CA file and can be read by
+	// `Context.PeerCertificate`.
+	ClientCAFile string
+	// ClientAuth is the policy of client certificates.  Default value is tls.RequireAndVerifyClientCert
+	// if ClientCAFile is set.
+	ClientAuth tls.ClientAuthType
+
+	// Network is "tcp" or "unix".  Default value is "tcp".  `Addr` is the socket path for "unix" network.
+	Network string
+	// Listener is used instead of listening on `Addr` if it is not nil
+	Listener net.Listener
+	// Signals stop the server gracefully.  Default values are SIGTERM and SIGINT.
+	Signals []os.Signal
+	// ShutdownDelay is the duration between the readiness flips to failing and the server stops accepting
+	// new connections, so the load balancer has time to remove the instance.  Default value is 0, which means
+	// the server stops right away and the 503 of the health middleware is never observed.  It MUST be set
+	// (ex: a bit longer than the health check interval of the load balancer) for readiness draining to work.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is the deadline to drain in-flight requests.  Default value is 30 seconds.
+	ShutdownTimeout time.Duration
+}
+
+// RunWithOptions runs the server until one of the signals is received and shuts the server down gracefully.
+func (s *WebServer) RunWithOptions(options ServerOptions) error {
+	return s.RunContext(context.Background(), options)
+}
+
+// RunContext is like RunWithOptions but the server is also shut down gracefully when the context is done.
+func (s *WebServer) RunContext(ctx context.Context, options ServerOptions) error {
+	ln := options.Listener
+	if ln == nil {
+		var err error
+		ln, err = listen(options.Network, options.Addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	serv := s.newServer(options)
+
+	useTLS := len(options.TLSCertFile) > 0 || len(options.TLSKeyFile) > 0 || len(options.Domain) > 0
+	if useTLS {
+		store, err := newCertStore(options)
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+
+		if err := store.watch(ctx); err != nil {
+			_ = ln.Close()
+			return err
+		}
+
+		serv.TLSConfig = store.tlsConfig(options.ClientAuth)
+	}
+
+	signals := options.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, signals...)
+	defer stop()
+
+	s.draining.Store(false)
+
+	errCh := make(chan error, 1)
+	go func() {
+		if useTLS {
+			// the certificates are provided by TLSConfig
+			errCh <- serv.ServeTLS(ln, "", "")
+			return
+		}
+		errCh <- serv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	s.draining.Store(true)
+
+	if options.ShutdownDelay > 0 {
+		time.Sleep(options.ShutdownDelay)
+	}
+
+	timeout := options.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeout)
+	defer shutdownCancel()
+
+	err := s.Shutdown(shutdownCtx)
+	<-errCh
+
+	return err
+}
+
+func listen(network string, addr string) (net.Listener, error) {
+	if len(network) == 0 {
+		network = "tcp"
+	}
+
+	if network == "unix" {
+		// remove the socket file which was left by the previous process
+		if fi, err := os.Stat(addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(addr)
+		}
+	}
+
+	if len(addr) == 0 && network == "tcp" {
+		addr = ":http"
+	}
+
+	return net.Listen(network, addr)
+}
+
+func (s *WebServer) newServer(options ServerOptions) *http.Server {
+	serv := &http.Server{
+		Addr:         options.Addr,
+		Handler:      s,
+		ReadTimeout:  options.ReadTimeout,
+		WriteTimeout: options.WriteTimeout,
+	}
+
+	s.mu.Lock()
+	s.server = serv
+	s.mu.Unlock()
+
+	return serv
 }
 
 // RunTLS will run http/2 server
 func (s *WebServer) RunTLS(addr, cert, key string) error {
-	serv := new(http.Server)
-	serv.Addr = addr
-	serv.Handler = s
+	serv := s.newServer(ServerOptions{Addr: addr})
 	return serv.ListenAndServeTLS(cert, key)
 }
 
 // Conforms to the http.Handler interface.
 func (s *WebServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	req.Body = http.MaxBytesReader(w, req.Body, s.MaxRequestBodySize)
+	var body *requestBody
+	if req.Body != nil {
+		body = newRequestBody(w, req.Body, s.MaxRequestBodySize)
+		req.Body = body
+	}
+
 	c, _ := s.pool.Get().(*Context)
+	// the context must be returned to the pool even if the handler panics
+	defer s.pool.Put(c)
+
 	c.reset(w, req)
+	c.body = body
 	_ = s.middleware.Execute(c)
-	s.pool.Put(c)
 }
 
 func build(handlers []MiddlewareHandler) middleware {
@@ -257,6 +470,30 @@ func build(handlers []MiddlewareHandler) middleware {
 	return middleware{handlers[0], &next}
 }
 
+// compose wraps the handler with the middleware chain. The error returned by the handler
+// is passed back to the caller so the router is able to hand it over to the ErrorHandler.
+func compose(handler HandlerFunc, mws []MiddlewareHandler) HandlerFunc {
+	h := handler
+
+	for i := len(mws) - 1; i >= 0; i-- {
+		mw := mws[i]
+		next := h
+
+		h = func(c *Context) error {
+			var err error
+
+			mw.Invoke(c, func(c *Context) error {
+				err = next(c)
+				return err
+			})
+
+			return err
+		}
+	}
+
+	return h
+}
+
 func voidMiddleware() middleware {
 	return middleware{
 		MiddlewareFunc(func(c *Context, next HandlerFunc) {}),
@@ -1,11 +1,17 @@
 package web
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net"
 	"net/http"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDefaultHandlers(t *testing.T) {
@@ -83,3 +89,126 @@ func TestMidderwareOrder(t *testing.T) {
 	assert.Equal(t, true, m2)
 	assert.Equal(t, true, m3)
 }
+
+func TestRunContextGracefulShutdown(t *testing.T) {
+	s := NewServer()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s.Get("/slow", func(c *Context) error {
+		close(started)
+		<-release
+		return c.String(200, "done")
+	})
+
+	s.Get("/ready", func(c *Context) error {
+		if !c.WebServer.IsReady() {
+			return c.String(503, "Service Unavailable")
+		}
+		return c.String(200, "OK")
+	})
+
+	flushed := false
+	s.OnShutdown(func() {
+		flushed = true
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.RunContext(ctx, ServerOptions{Listener: ln, ShutdownDelay: 500 * time.Millisecond, ShutdownTimeout: 5 * time.Second})
+	}()
+
+	readiness := func() int {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/ready")
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		respCh <- string(b)
+	}()
+
+	<-started
+	assert.True(t, s.IsReady())
+	assert.Equal(t, 200, readiness())
+	cancel()
+
+	assert.Eventually(t, func() bool { return !s.IsReady() }, time.Second, 10*time.Millisecond)
+
+	// the server still accepts new requests during the delay, so the load balancer observes the failing readiness
+	assert.Equal(t, 503, readiness())
+
+	// the in-flight request is drained
+	close(release)
+	assert.Equal(t, "done", <-respCh)
+	assert.NoError(t, <-runErr)
+	assert.True(t, flushed)
+}
+
+func TestRunContextUnixSocket(t *testing.T) {
+	s := NewServer()
+	s.Get("/", func(c *Context) error {
+		return c.String(200, "unix")
+	})
+
+	sock := filepath.Join(t.TempDir(), "web.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.RunContext(ctx, ServerOptions{Network: "unix", Addr: sock})
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = client.Get("http://unix/")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "unix", string(b))
+
+	cancel()
+	assert.NoError(t, <-runErr)
+}
+
+func TestRunTLSStoresServer(t *testing.T) {
+	s := NewServer()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.RunTLS("127.0.0.1:0", "not_found.crt", "not_found.key")
+	}()
+
+	// the certificate can't be loaded, but the server was stored so Shutdown works
+	assert.Error(t, <-runErr)
+	assert.NotNil(t, s.server)
+	assert.NoError(t, s.Shutdown(context.Background()))
+}
@@ -0,0 +1,794 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, see RFC 6455 section 11.8
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// WebSocket close codes, see RFC 6455 section 11.7
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	continuationFrame = 0
+
+	finalBit = 0x80
+	rsv1Bit  = 0x40
+	rsv2Bit  = 0x20
+	rsv3Bit  = 0x10
+	maskBit  = 0x80
+
+	maxControlPayloadSize = 125
+	defaultWSReadLimit    = 32 << 20 // 32MB
+
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	// ErrWSClosed is returned when a message is written after the close frame was sent
+	ErrWSClosed = errors.New("web: websocket connection is closed")
+	// ErrWSMessageType is returned when the message type is invalid
+	ErrWSMessageType = errors.New("web: websocket message type is invalid")
+	// ErrWSControlTooLong is returned when the payload of a control message is longer than 125 bytes
+	ErrWSControlTooLong = errors.New("web: websocket control message is too long")
+
+	// the tail of a deflate stream which is removed by the sender, plus an empty final block, see RFC 7692 section 7.2.2
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+	flateWriterPool = sync.Pool{
+		New: func() interface{} {
+			w, _ := flate.NewWriter(nil, flate.BestSpeed)
+			return w
+		},
+	}
+)
+
+// CloseError is returned when the connection is closed by a close frame
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	s := "web: websocket closed with code " + strconv.Itoa(e.Code)
+	if len(e.Text) > 0 {
+		s += ": " + e.Text
+	}
+	return s
+}
+
+// WSHandler defines a function to serve WebSocket connections
+type WSHandler func(conn *WSConn) error
+
+// WebSocketOptions is a configuration container to setup the WebSocket handshake
+type WebSocketOptions struct {
+	// Subprotocols are the protocols which are supported by the server in order of preference
+	Subprotocols []string
+	// CheckOrigin returns true if the origin is allowed.  The default function allows the request which doesn't
+	// have the `Origin` header or the host of origin equals to the `Host` header.
+	CheckOrigin func(c *Context) bool
+	// EnableCompression negotiates the permessage-deflate extension (RFC 7692) with the client
+	EnableCompression bool
+	// ReadLimit is the maximum size of a message.  Default value is 32MB.
+	ReadLimit int64
+}
+
+// WebSocket registers a new WebSocket route for a path with default options
+func (s *WebServer) WebSocket(path string, handler WSHandler, mws ...MiddlewareHandler) *Route {
+	return s.router.Add(GET, path, WrapWebSocket(handler, WebSocketOptions{}), mws...)
+}
+
+// WebSocket registers a new WebSocket route for a path with default options
+func (g *RouterGroup) WebSocket(path string, handler WSHandler, mws ...MiddlewareHandler) *Route {
+	return g.Add(GET, path, WrapWebSocket(handler, WebSocketOptions{}), mws...)
+}
+
+// WrapWebSocket wraps `WSHandler` into `web.HandlerFunc`.  The connection is closed with normal closure code when
+// the handler returns nil and with internal error code when the handler returns an error.
+func WrapWebSocket(handler WSHandler, options WebSocketOptions) HandlerFunc {
+	return func(c *Context) error {
+		conn, err := upgradeWebSocket(c, options)
+		if err != nil {
+			return err
+		}
+
+		err = handler(conn)
+
+		var closeErr *CloseError
+		if err != nil && !errors.As(err, &closeErr) && !errors.Is(err, ErrWSClosed) && !errors.Is(err, net.ErrClosed) {
+			_ = conn.WriteClose(CloseInternalServerErr, "")
+			_ = conn.Close()
+			return err
+		}
+
+		_ = conn.Close()
+		return nil
+	}
+}
+
+func upgradeWebSocket(c *Context, options WebSocketOptions) (*WSConn, error) {
+	req := c.Request
+
+	if req.Method != http.MethodGet {
+		return nil, NewHTTPError(http.StatusMethodNotAllowed)
+	}
+
+	if !headerContainsToken(req.Header, "Connection", "upgrade") || !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return nil, NewHTTPError(http.StatusBadRequest, "websocket: the request is not a websocket upgrade request")
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.RespHeader("Sec-WebSocket-Version", "13")
+		return nil, NewHTTPError(http.StatusUpgradeRequired)
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, NewHTTPError(http.StatusBadRequest, "websocket: Sec-WebSocket-Key is invalid")
+	}
+
+	checkOrigin := options.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+
+	if !checkOrigin(c) {
+		return nil, NewHTTPError(http.StatusForbidden, "websocket: origin is not allowed")
+	}
+
+	if req.ProtoMajor != 1 {
+		return nil, NewHTTPError(http.StatusInternalServerError, "websocket: the connection can't be hijacked")
+	}
+
+	subprotocol := selectSubprotocol(req, options.Subprotocols)
+	compress := options.EnableCompression && acceptDeflate(req)
+
+	netConn, brw, err := http.NewResponseController(c.Writer).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	if rw, ok := c.Writer.(*responseWriter); ok {
+		rw.status = http.StatusSwitchingProtocols
+	}
+
+	// the deadlines which were set by http.Server are cleared
+	_ = netConn.SetDeadline(time.Time{})
+
+	var buf bytes.Buffer
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	buf.WriteString(acceptKey(key))
+	buf.WriteString("\r\n")
+
+	if len(subprotocol) > 0 {
+		buf.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+
+	if compress {
+		buf.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+
+	buf.WriteString("\r\n")
+
+	if _, err := netConn.Write(buf.Bytes()); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	readLimit := options.ReadLimit
+	if readLimit <= 0 {
+		readLimit = defaultWSReadLimit
+	}
+
+	conn := &WSConn{
+		conn:        netConn,
+		reader:      brw.Reader,
+		context:     c,
+		subprotocol: subprotocol,
+		compress:    compress,
+		readLimit:   readLimit,
+	}
+
+	conn.pingHandler = func(data []byte) error {
+		return conn.writeControl(PongMessage, data)
+	}
+
+	return conn, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New() //nolint:gosec
+	_, _ = h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameOrigin(c *Context) bool {
+	origin := c.RequestHeader("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, c.Request.Host)
+}
+
+func selectSubprotocol(req *http.Request, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+
+	var requested []string
+	for _, value := range req.Header["Sec-Websocket-Protocol"] {
+		for _, v := range strings.Split(value, ",") {
+			requested = append(requested, strings.TrimSpace(v))
+		}
+	}
+
+	for _, protocol := range supported {
+		for _, r := range requested {
+			if r == protocol {
+				return protocol
+			}
+		}
+	}
+
+	return ""
+}
+
+// acceptDeflate returns true if the client offers permessage-deflate with parameters which can be accepted.
+// The window size of compress/flate can't be changed, so the offer which limits the server window is declined.
+func acceptDeflate(req *http.Request) bool {
+	for _, value := range req.Header["Sec-Websocket-Extensions"] {
+	offers:
+		for _, offer := range strings.Split(value, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+
+			for _, param := range params[1:] {
+				name, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				val = strings.Trim(strings.TrimSpace(val), `"`)
+
+				switch strings.TrimSpace(name) {
+				case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+				case "server_max_window_bits":
+					if val != "15" {
+						continue offers
+					}
+				default:
+					continue offers
+				}
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// WSConn is a WebSocket connection.  Only one goroutine can read at the same time.  Writing a message is safe
+// to be called concurrently, but the writer which is returned by `NextWriter` must not be used concurrently
+// with other data messages.
+type WSConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	context     *Context
+	subprotocol string
+	compress    bool
+	readLimit   int64
+	readErr     error
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+}
+
+// Context returns the context of the upgrade request.  The context is only valid before the handler returns.
+func (ws *WSConn) Context() *Context {
+	return ws.context
+}
+
+// Subprotocol returns the negotiated subprotocol
+func (ws *WSConn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// RemoteAddr returns the remote network address
+func (ws *WSConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadLimit sets the maximum size of a message.  The connection is closed with `CloseMessageTooBig` code
+// if a message exceeds the limit.
+func (ws *WSConn) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
+// SetReadDeadline sets the read deadline on the underlying connection.  A zero value means reads will not time out.
+func (ws *WSConn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline on the underlying connection.  A zero value means writes will not time out.
+func (ws *WSConn) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+// SetPingHandler sets the handler of ping messages.  The default handler replies a pong message with the same data.
+func (ws *WSConn) SetPingHandler(handler func(data []byte) error) {
+	if handler == nil {
+		handler = func(data []byte) error {
+			return ws.writeControl(PongMessage, data)
+		}
+	}
+	ws.pingHandler = handler
+}
+
+// SetPongHandler sets the handler of pong messages, ex: extend the read deadline.
+func (ws *WSConn) SetPongHandler(handler func(data []byte) error) {
+	ws.pongHandler = handler
+}
+
+// ReadMessage reads the next text or binary message.  Fragmented messages are assembled and the control messages
+// are handled while reading.  `*CloseError` is returned when the close frame is received.
+func (ws *WSConn) ReadMessage() (int, []byte, error) {
+	if ws.readErr != nil {
+		return 0, nil, ws.readErr
+	}
+
+	messageType, data, err := ws.readMessage()
+	if err != nil {
+		ws.readErr = err
+	}
+
+	return messageType, data, err
+}
+
+func (ws *WSConn) readMessage() (int, []byte, error) {
+	var (
+		messageType int
+		compressed  bool
+		buf         []byte
+	)
+
+	for {
+		f, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case PingMessage, PongMessage, CloseMessage:
+			if err := ws.handleControl(f); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "websocket: fragmented message is not finished")
+			}
+			messageType = f.opcode
+			compressed = f.rsv1
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "websocket: unexpected continuation frame")
+			}
+
+			if f.rsv1 {
+				return 0, nil, ws.fail(CloseProtocolError, "websocket: reserved bits are set")
+			}
+		default:
+			return 0, nil, ws.fail(CloseProtocolError, "websocket: unknown opcode "+strconv.Itoa(f.opcode))
+		}
+
+		if int64(len(buf))+int64(len(f.payload)) > ws.readLimit {
+			return 0, nil, ws.fail(CloseMessageTooBig, "websocket: message is too big")
+		}
+
+		buf = append(buf, f.payload...)
+
+		if !f.fin {
+			continue
+		}
+
+		if compressed {
+			buf, err = ws.decompress(buf)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+
+		if messageType == TextMessage && !utf8.Valid(buf) {
+			return 0, nil, ws.fail(CloseInvalidFramePayloadData, "websocket: invalid utf-8 text")
+		}
+
+		return messageType, buf, nil
+	}
+}
+
+type wsFrame struct {
+	fin     bool
+	rsv1    bool
+	opcode  int
+	payload []byte
+}
+
+func (ws *WSConn) readFrame() (wsFrame, error) {
+	var (
+		f      wsFrame
+		header [8]byte
+	)
+
+	if _, err := io.ReadFull(ws.reader, header[:2]); err != nil {
+		return f, err
+	}
+
+	f.fin = header[0]&finalBit != 0
+	f.rsv1 = header[0]&rsv1Bit != 0
+	f.opcode = int(header[0] & 0x0f)
+	isControl := f.opcode&0x08 != 0
+
+	if header[0]&(rsv2Bit|rsv3Bit) != 0 || (f.rsv1 && (!ws.compress || isControl)) {
+		return f, ws.fail(CloseProtocolError, "websocket: reserved bits are set")
+	}
+
+	if header[1]&maskBit == 0 {
+		return f, ws.fail(CloseProtocolError, "websocket: client frame is not masked")
+	}
+
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(ws.reader, header[:2]); err != nil {
+			return f, err
+		}
+		length = uint64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err := io.ReadFull(ws.reader, header[:8]); err != nil {
+			return f, err
+		}
+		length = binary.BigEndian.Uint64(header[:8])
+		if length>>63 != 0 {
+			return f, ws.fail(CloseProtocolError, "websocket: payload length is invalid")
+		}
+	}
+
+	if isControl && (!f.fin || length > maxControlPayloadSize) {
+		return f, ws.fail(CloseProtocolError, "websocket: control frame is invalid")
+	}
+
+	if length > uint64(ws.readLimit) { //nolint:gosec
+		return f, ws.fail(CloseMessageTooBig, "websocket: message is too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return f, err
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, f.payload); err != nil {
+		return f, err
+	}
+
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+
+	return f, nil
+}
+
+func (ws *WSConn) handleControl(f wsFrame) error {
+	switch f.opcode {
+	case PingMessage:
+		if ws.pingHandler != nil {
+			return ws.pingHandler(f.payload)
+		}
+	case PongMessage:
+		if ws.pongHandler != nil {
+			return ws.pongHandler(f.payload)
+		}
+	case CloseMessage:
+		code := CloseNoStatusReceived
+		text := ""
+
+		switch {
+		case len(f.payload) == 1:
+			return ws.fail(CloseProtocolError, "websocket: close frame is invalid")
+		case len(f.payload) >= 2:
+			code = int(binary.BigEndian.Uint16(f.payload))
+			text = string(f.payload[2:])
+
+			if !isValidCloseCode(code) {
+				return ws.fail(CloseProtocolError, "websocket: close code is invalid")
+			}
+
+			if !utf8.ValidString(text) {
+				return ws.fail(CloseInvalidFramePayloadData, "websocket: invalid utf-8 close reason")
+			}
+		}
+
+		// echo the close code to complete the closing handshake
+		replyCode := code
+		if replyCode == CloseNoStatusReceived {
+			replyCode = CloseNormalClosure
+		}
+		_ = ws.WriteClose(replyCode, "")
+
+		return &CloseError{Code: code, Text: text}
+	}
+
+	return nil
+}
+
+func isValidCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail sends the close frame with the code and returns the error
+func (ws *WSConn) fail(code int, text string) error {
+	_ = ws.WriteClose(code, "")
+	return &CloseError{Code: code, Text: text}
+}
+
+func (ws *WSConn) decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail)))
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, ws.readLimit+1))
+	if err != nil {
+		return nil, ws.fail(CloseProtocolError, "websocket: decompress message failed")
+	}
+
+	if int64(len(b)) > ws.readLimit {
+		return nil, ws.fail(CloseMessageTooBig, "websocket: message is too big")
+	}
+
+	return b, nil
+}
+
+// WriteMessage writes a message.  Text and binary messages are compressed if permessage-deflate was negotiated.
+func (ws *WSConn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+	case PingMessage, PongMessage:
+		return ws.writeControl(messageType, data)
+	default:
+		return ErrWSMessageType
+	}
+
+	if !ws.compress {
+		return ws.writeFrame(true, false, messageType, data)
+	}
+
+	var buf bytes.Buffer
+
+	fw, _ := flateWriterPool.Get().(*flate.Writer)
+	fw.Reset(&buf)
+	_, _ = fw.Write(data)
+	_ = fw.Flush()
+	flateWriterPool.Put(fw)
+
+	return ws.writeFrame(true, true, messageType, bytes.TrimSuffix(buf.Bytes(), deflateTail[:4]))
+}
+
+// WriteText writes a text message
+func (ws *WSConn) WriteText(text string) error {
+	return ws.WriteMessage(TextMessage, []byte(text))
+}
+
+// Ping writes a ping message
+func (ws *WSConn) Ping(data []byte) error {
+	return ws.writeControl(PingMessage, data)
+}
+
+// WriteClose writes a close frame with the code and reason.  No more messages can be written after the close frame.
+func (ws *WSConn) WriteClose(code int, text string) error {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code)) //nolint:gosec
+	payload = append(payload, text...)
+
+	if len(payload) > maxControlPayloadSize {
+		return ErrWSControlTooLong
+	}
+
+	return ws.writeFrame(true, false, CloseMessage, payload)
+}
+
+// Close sends the close frame with normal closure code if it has not been sent and closes the connection
+func (ws *WSConn) Close() error {
+	_ = ws.WriteClose(CloseNormalClosure, "")
+	return ws.conn.Close()
+}
+
+func (ws *WSConn) writeControl(opcode int, data []byte) error {
+	if len(data) > maxControlPayloadSize {
+		return ErrWSControlTooLong
+	}
+	return ws.writeFrame(true, false, opcode, data)
+}
+
+func (ws *WSConn) writeFrame(fin bool, rsv1 bool, opcode int, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closeSent {
+		return ErrWSClosed
+	}
+
+	frame := make([]byte, 0, 10+len(payload))
+
+	b := byte(opcode)
+	if fin {
+		b |= finalBit
+	}
+	if rsv1 {
+		b |= rsv1Bit
+	}
+	frame = append(frame, b)
+
+	switch length := len(payload); {
+	case length <= maxControlPayloadSize:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	frame = append(frame, payload...)
+
+	if opcode == CloseMessage {
+		ws.closeSent = true
+	}
+
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// NextWriter returns a writer which writes a fragmented message.  Every `Write` call sends a frame and `Close`
+// sends the final frame.
+func (ws *WSConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, ErrWSMessageType
+	}
+
+	w := &wsMessageWriter{
+		conn:   ws,
+		opcode: messageType,
+	}
+
+	if ws.compress {
+		w.flate, _ = flateWriterPool.Get().(*flate.Writer)
+		w.flate.Reset(&w.buf)
+	}
+
+	return w, nil
+}
+
+type wsMessageWriter struct {
+	conn   *WSConn
+	opcode int
+	sent   bool
+	closed bool
+	flate  *flate.Writer
+	buf    bytes.Buffer
+}
+
+func (w *wsMessageWriter) writeFrame(fin bool, payload []byte) error {
+	opcode := continuationFrame
+	if !w.sent {
+		opcode = w.opcode
+	}
+
+	err := w.conn.writeFrame(fin, w.flate != nil && !w.sent, opcode, payload)
+	w.sent = true
+	return err
+}
+
+func (w *wsMessageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrWSClosed
+	}
+
+	if w.flate == nil {
+		if err := w.writeFrame(false, p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	_, _ = w.flate.Write(p)
+	_ = w.flate.Flush()
+
+	// the last 4 bytes are kept, because the tail of the final frame must be removed
+	data := w.buf.Bytes()
+	if len(data) > 4 {
+		if err := w.writeFrame(false, data[:len(data)-4]); err != nil {
+			return 0, err
+		}
+
+		tail := append([]byte{}, data[len(data)-4:]...)
+		w.buf.Reset()
+		w.buf.Write(tail)
+	}
+
+	return len(p), nil
+}
+
+func (w *wsMessageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.flate == nil {
+		return w.writeFrame(true, nil)
+	}
+
+	_ = w.flate.Flush()
+	flateWriterPool.Put(w.flate)
+
+	return w.writeFrame(true, bytes.TrimSuffix(w.buf.Bytes(), deflateTail[:4]))
+}
@@ -0,0 +1,308 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type wsTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	resp   *http.Response
+}
+
+func dialWebSocket(t *testing.T, serverURL string, path string, header map[string]string) *wsTestClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := "GET " + path + " HTTP/1.1\r\nHost: " + strings.TrimPrefix(serverURL, "http://") + "\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	for k, v := range header {
+		req += k + ": " + v + "\r\n"
+	}
+	req += "\r\n"
+
+	_, err = conn.Write([]byte(req))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+
+	return &wsTestClient{conn: conn, reader: reader, resp: resp}
+}
+
+func (client *wsTestClient) writeFrame(t *testing.T, header byte, payload []byte, masked bool) {
+	frame := []byte{header}
+
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	data := append([]byte{}, payload...)
+	if masked {
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+
+	_, err := client.conn.Write(append(frame, data...))
+	require.NoError(t, err)
+}
+
+func (client *wsTestClient) readFrame(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(client.reader, header[:])
+	require.NoError(t, err)
+
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		_, _ = io.ReadFull(client.reader, b[:])
+		length = int(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		_, _ = io.ReadFull(client.reader, b[:])
+		length = int(binary.BigEndian.Uint64(b[:]))
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(client.reader, payload)
+	require.NoError(t, err)
+
+	return header[0], payload
+}
+
+func (client *wsTestClient) readClose(t *testing.T) int {
+	header, payload := client.readFrame(t)
+	require.Equal(t, byte(0x80|CloseMessage), header)
+	require.GreaterOrEqual(t, len(payload), 2)
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+func newWebSocketTestServer(t *testing.T, options WebSocketOptions) *httptest.Server {
+	s := NewServer()
+	s.Get("/echo", WrapWebSocket(func(conn *WSConn) error {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return err
+			}
+
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return err
+			}
+		}
+	}, options))
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	server := newWebSocketTestServer(t, WebSocketOptions{Subprotocols: []string{"chat"}})
+
+	client := dialWebSocket(t, server.URL, "/echo", map[string]string{"Sec-WebSocket-Protocol": "superchat, chat"})
+	assert.Equal(t, 101, client.resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", client.resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "chat", client.resp.Header.Get("Sec-WebSocket-Protocol"))
+
+	client.writeFrame(t, 0x80|TextMessage, []byte("hello"), true)
+	header, payload := client.readFrame(t)
+	assert.Equal(t, byte(0x80|TextMessage), header)
+	assert.Equal(t, "hello", string(payload))
+
+	// 16 bits payload length
+	large := bytes.Repeat([]byte("a"), 1000)
+	client.writeFrame(t, 0x80|BinaryMessage, large, true)
+	header, payload = client.readFrame(t)
+	assert.Equal(t, byte(0x80|BinaryMessage), header)
+	assert.Equal(t, large, payload)
+
+	// fragmented message with a ping in the middle
+	client.writeFrame(t, TextMessage, []byte("hel"), true)
+	client.writeFrame(t, 0x80|PingMessage, []byte("ping"), true)
+	client.writeFrame(t, continuationFrame, []byte("lo "), true)
+	client.writeFrame(t, 0x80|continuationFrame, []byte("world"), true)
+
+	header, payload = client.readFrame(t)
+	assert.Equal(t, byte(0x80|PongMessage), header)
+	assert.Equal(t, "ping", string(payload))
+
+	header, payload = client.readFrame(t)
+	assert.Equal(t, byte(0x80|TextMessage), header)
+	assert.Equal(t, "hello world", string(payload))
+
+	// closing handshake
+	client.writeFrame(t, 0x80|CloseMessage, []byte{0x03, 0xe9}, true)
+	assert.Equal(t, CloseGoingAway, client.readClose(t))
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	server := newWebSocketTestServer(t, WebSocketOptions{ReadLimit: 10})
+
+	testCases := []struct {
+		name    string
+		header  byte
+		payload []byte
+		masked  bool
+		code    int
+	}{
+		{"unmasked frame", 0x80 | TextMessage, []byte("hi"), false, CloseProtocolError},
+		{"reserved bits", 0x80 | 0x40 | TextMessage, []byte("hi"), true, CloseProtocolError},
+		{"unexpected continuation", 0x80 | continuationFrame, []byte("hi"), true, CloseProtocolError},
+		{"message too big", 0x80 | TextMessage, []byte("hello world"), true, CloseMessageTooBig},
+		{"invalid utf-8", 0x80 | TextMessage, []byte{0xff, 0xfe}, true, CloseInvalidFramePayloadData},
+		{"invalid close code", 0x80 | CloseMessage, []byte{0x03, 0xed}, true, CloseProtocolError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := dialWebSocket(t, server.URL, "/echo", nil)
+			client.writeFrame(t, tc.header, tc.payload, tc.masked)
+			assert.Equal(t, tc.code, client.readClose(t))
+		})
+	}
+}
+
+func TestWebSocketCompression(t *testing.T) {
+	server := newWebSocketTestServer(t, WebSocketOptions{EnableCompression: true})
+
+	client := dialWebSocket(t, server.URL, "/echo", map[string]string{
+		"Sec-WebSocket-Extensions": "permessage-deflate; server_max_window_bits=10, permessage-deflate; client_max_window_bits",
+	})
+	assert.Equal(t, "permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+		client.resp.Header.Get("Sec-WebSocket-Extensions"))
+
+	message := strings.Repeat("compress me ", 100)
+
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = fw.Write([]byte(message))
+	_ = fw.Flush()
+	compressed := bytes.TrimSuffix(buf.Bytes(), []byte{0x00, 0x00, 0xff, 0xff})
+
+	// the compressed message is fragmented
+	client.writeFrame(t, 0x40|TextMessage, compressed[:10], true)
+	client.writeFrame(t, 0x80|continuationFrame, compressed[10:], true)
+
+	header, payload := client.readFrame(t)
+	assert.Equal(t, byte(0x80|0x40|TextMessage), header)
+	assert.Less(t, len(payload), len(message))
+
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTail)))
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, message, string(b))
+}
+
+func TestWebSocketNextWriter(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		s := NewServer()
+		s.Get("/", WrapWebSocket(func(conn *WSConn) error {
+			w, err := conn.NextWriter(TextMessage)
+			if err != nil {
+				return err
+			}
+			_, _ = w.Write([]byte("hello "))
+			_, _ = w.Write([]byte("world"))
+			return w.Close()
+		}, WebSocketOptions{EnableCompression: compress}))
+
+		server := httptest.NewServer(s)
+
+		client := dialWebSocket(t, server.URL, "/", map[string]string{"Sec-WebSocket-Extensions": "permessage-deflate"})
+
+		var (
+			message []byte
+			first   byte
+		)
+
+		for {
+			header, payload := client.readFrame(t)
+			if first == 0 {
+				first = header
+			}
+			message = append(message, payload...)
+			if header&0x80 != 0 {
+				break
+			}
+		}
+
+		assert.Equal(t, byte(TextMessage), first&0x0f)
+
+		if compress {
+			assert.Equal(t, byte(0x40), first&0x40)
+			r := flate.NewReader(io.MultiReader(bytes.NewReader(message), bytes.NewReader(deflateTail)))
+			message, _ = io.ReadAll(r)
+		}
+
+		assert.Equal(t, "hello world", string(message))
+		assert.Equal(t, CloseNormalClosure, client.readClose(t))
+
+		server.Close()
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	s := NewServer()
+	s.WebSocket("/ws", func(conn *WSConn) error {
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ws", nil)
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 426, w.Code)
+	assert.Equal(t, "13", w.Header().Get("Sec-WebSocket-Version"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://example.com/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Origin", "http://evil.com")
+	s.ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+}